@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errAlreadyRegistered = errors.New("already registered")
+	errActivityFull      = errors.New("activity is full")
+	errScheduleConflict  = errors.New("overlaps another registered activity")
+)
+
+// registerForActivity registers user for activityID, enforcing capacity and,
+// unless allowConflicts is set, rejecting overlaps with the user's other
+// activities. The activity row is locked so concurrent registrations can't
+// overbook it. A cancelled registration is reactivated rather than duplicated.
+// The overlapping activities are returned alongside errScheduleConflict, or
+// as warnings when conflicts are allowed.
+func registerForActivity(stores Stores, user User, activityID uuid.UUID, allowConflicts bool) (ActivityRegistration, []Activity, error) {
+	var reg ActivityRegistration
+	var overlaps []Activity
+	err := stores.Transaction(func(tx Stores) error {
+		activity, err := tx.Activities.GetForUpdate(activityID)
+		if err != nil {
+			return err
+		}
+
+		existing, err := tx.Registrations.FindActivity(activityID, user.ID)
+		found := err == nil
+		if found && existing.Status != "cancelled" {
+			return errAlreadyRegistered
+		}
+
+		if activity.Capacity > 0 {
+			taken, err := tx.Registrations.CountActiveForActivity(activityID)
+			if err != nil {
+				return err
+			}
+			if taken >= int64(activity.Capacity) {
+				return errActivityFull
+			}
+		}
+
+		overlaps, err = tx.Registrations.ActivityConflicts(user.ID, activity)
+		if err != nil {
+			return err
+		}
+		if len(overlaps) > 0 && !allowConflicts {
+			return errScheduleConflict
+		}
+
+		if found {
+			reg = existing
+			return tx.Registrations.SetActivityStatus(&reg, "registered")
+		}
+		reg = ActivityRegistration{
+			ActivityID: activityID,
+			UserID:     user.ID,
+			UserUSN:    user.USN,
+			Status:     "registered",
+		}
+		if err := tx.Registrations.CreateActivity(&reg); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errAlreadyRegistered
+			}
+			return err
+		}
+		return nil
+	})
+	return reg, overlaps, err
+}
+
+// writeActivityRegisterError maps registerForActivity errors to responses.
+func writeActivityRegisterError(w http.ResponseWriter, err error, overlaps []Activity) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Activity not found", http.StatusNotFound)
+	case errors.Is(err, errAlreadyRegistered):
+		http.Error(w, "Already registered for this activity", http.StatusConflict)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		http.Error(w, "Activity no longer exists", http.StatusConflict)
+	case errors.Is(err, errActivityFull):
+		http.Error(w, "Activity is full", http.StatusConflict)
+	case errors.Is(err, errScheduleConflict):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":     "Activity overlaps with your schedule",
+			"conflicts": overlaps,
+		})
+	default:
+		http.Error(w, "Registration failed", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleActivityCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := s.getUserIDFromToken(r)
+	if userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		ActivityID uuid.UUID `json:"activity_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	reg, err := s.Registrations.FindActivity(input.ActivityID, userID)
+	if err != nil || reg.Status == "cancelled" {
+		http.Error(w, "Not registered for this activity", http.StatusNotFound)
+		return
+	}
+	if err := s.Registrations.SetActivityStatus(&reg, "cancelled"); err != nil {
+		http.Error(w, "Cancellation failed", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reg)
+}
+
+type scheduleItem struct {
+	Kind           string      `json:"kind"` // 'event' or 'activity'
+	ID             uuid.UUID   `json:"id"`
+	RegistrationID uuid.UUID   `json:"registration_id"`
+	Title          string      `json:"title"`
+	Location       string      `json:"location"`
+	StartTime      time.Time   `json:"start_time"`
+	EndTime        time.Time   `json:"end_time"`
+	Status         string      `json:"status"`
+	ConflictsWith  []uuid.UUID `json:"conflicts_with,omitempty"` // Overlapping activities
+}
+
+// handleMySchedule lists the caller's registered events and activities in
+// chronological order. ?from= limits it to items ending after that time.
+func (s *Server) handleMySchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := s.getUserIDFromToken(r)
+	if userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var from time.Time
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	regs, _ := s.Registrations.ListActiveForUser(userID)
+	activityRegs, _ := s.Registrations.ListActiveActivitiesForUser(userID)
+
+	items := []scheduleItem{}
+	for _, reg := range regs {
+		if reg.Event == nil {
+			continue
+		}
+		items = append(items, scheduleItem{
+			Kind:           "event",
+			ID:             reg.Event.ID,
+			RegistrationID: reg.ID,
+			Title:          reg.Event.Title,
+			Location:       reg.Event.Location,
+			StartTime:      reg.Event.EventDate,
+			EndTime:        reg.Event.EventDate.Add(defaultEventDuration),
+			Status:         reg.Status,
+		})
+	}
+	firstActivity := len(items)
+	for _, reg := range activityRegs {
+		if reg.Activity == nil {
+			continue
+		}
+		items = append(items, scheduleItem{
+			Kind:           "activity",
+			ID:             reg.Activity.ID,
+			RegistrationID: reg.ID,
+			Title:          reg.Activity.Title,
+			Location:       reg.Activity.Location,
+			StartTime:      reg.Activity.StartTime,
+			EndTime:        reg.Activity.EndTime,
+			Status:         reg.Status,
+		})
+	}
+
+	// Flag overlapping activities; events contain their agenda, so they're left out.
+	activities := items[firstActivity:]
+	for i := range activities {
+		for j := range activities {
+			if i != j && activities[i].StartTime.Before(activities[j].EndTime) && activities[j].StartTime.Before(activities[i].EndTime) {
+				activities[i].ConflictsWith = append(activities[i].ConflictsWith, activities[j].ID)
+			}
+		}
+	}
+
+	schedule := items[:0]
+	for _, item := range items {
+		if item.EndTime.After(from) {
+			schedule = append(schedule, item)
+		}
+	}
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].StartTime.Before(schedule[j].StartTime)
+	})
+	json.NewEncoder(w).Encode(schedule)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// validateActivitySchedule checks an activity's times and, if it belongs to
+// an event, that it takes place within that event's day.
+func validateActivitySchedule(events EventStore, loc *time.Location, activity Activity) error {
+	if activity.EndTime.Before(activity.StartTime) {
+		return errors.New("end_time is before start_time")
+	}
+	if activity.EventID == nil {
+		return nil
+	}
+
+	event, err := events.Get(*activity.EventID)
+	if err != nil {
+		return fmt.Errorf("no event with id %s", *activity.EventID)
+	}
+	day := event.EventDate.In(loc)
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	if activity.StartTime.Before(dayStart) || activity.EndTime.After(dayEnd) {
+		return fmt.Errorf("activity must take place on the event's day (%s)", dayStart.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// normalizeActivityEventID treats an all-zero event_id, which older clients
+// send for standalone activities, as no parent event.
+func normalizeActivityEventID(activity *Activity) {
+	if activity.EventID != nil && *activity.EventID == uuid.Nil {
+		activity.EventID = nil
+	}
+}
+
+// prepareActivityEventLinks clears parent links that can't satisfy the
+// activities -> events foreign key, so AutoMigrate can add it. Before the
+// link became nullable, standalone activities stored the nil UUID.
+func prepareActivityEventLinks(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Activity{}) || !db.Migrator().HasTable(&Event{}) {
+		return nil
+	}
+	result := db.Exec("UPDATE activities SET event_id = NULL WHERE event_id IS NOT NULL AND event_id NOT IN (SELECT id FROM events)")
+	if result.Error != nil {
+		return fmt.Errorf("clearing dangling activity event links: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Cleared %d dangling activity event links", result.RowsAffected)
+	}
+	return nil
+}
+
+// handleEventDetail returns one event with its agenda of activities.
+func (s *Server) handleEventDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	v := s.viewerFromRequest(r)
+	event, err := s.Events.GetWithAgenda(v, eventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if !s.Events.CanAccess(v, event.ID) {
+		http.Error(w, "Access Denied: Event restricted to group members", http.StatusForbidden)
+		return
+	}
+	// Unlike list responses, the detail view always carries the agenda key.
+	agenda := event.Activities
+	if agenda == nil {
+		agenda = []Activity{}
+	}
+	json.NewEncoder(w).Encode(struct {
+		Event
+		Activities []Activity `json:"activities"`
+	}{event, agenda})
+}
+
+// handleEventActivities lists the agenda of one event.
+func (s *Server) handleEventActivities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.Events.Get(eventID); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	v := s.viewerFromRequest(r)
+	if !s.Events.CanAccess(v, eventID) {
+		http.Error(w, "Access Denied: Event restricted to group members", http.StatusForbidden)
+		return
+	}
+
+	activities, _ := s.Activities.List(v, &eventID)
+	if activities == nil {
+		activities = []Activity{}
+	}
+	json.NewEncoder(w).Encode(activities)
+}
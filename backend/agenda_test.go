@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestValidateActivityScheduleUsesConfiguredZone checks that an event's day
+// is taken in the configured zone, not the server's: late-evening IST
+// events are on the previous day in UTC.
+func TestValidateActivityScheduleUsesConfiguredZone(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := newMemoryStores()
+	event := Event{Title: "Night hack", EventDate: time.Date(2026, 11, 2, 0, 30, 0, 0, ist)}
+	if err := stores.Events.Create(&event); err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour int) time.Time { return time.Date(2026, 11, 2, hour, 0, 0, 0, ist) }
+	activity := Activity{Title: "Demos", EventID: &event.ID, StartTime: at(20), EndTime: at(22)}
+
+	if err := validateActivitySchedule(stores.Events, ist, activity); err != nil {
+		t.Errorf("IST: %v", err)
+	}
+	// The same instants seen from UTC: the event is on 1 Nov, the activity on 2 Nov.
+	if err := validateActivitySchedule(stores.Events, time.UTC, activity); err == nil {
+		t.Error("UTC: accepted an activity on another day")
+	}
+
+	// The result must not depend on the server's own zone.
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	for _, local := range []*time.Location{time.UTC, ist, time.FixedZone("UTC-10", -10*3600)} {
+		time.Local = local
+		if err := validateActivitySchedule(stores.Events, ist, activity); err != nil {
+			t.Errorf("server in %s: %v", local, err)
+		}
+	}
+}
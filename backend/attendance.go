@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errNotCheckedIn = errors.New("registration is not checked in")
+
+// checkOutRegistration closes the open attendance session of reg.
+func checkOutRegistration(regs RegistrationStore, reg *Registration, at time.Time) error {
+	if reg.Status != "checked_in" {
+		return errNotCheckedIn
+	}
+	return regs.CheckOut(reg, at)
+}
+
+func (s *Server) handleEventCheckOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		QRCodeToken string `json:"qr_code_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var reg Registration
+	err := s.Transaction(func(tx Stores) error {
+		var err error
+		if reg, err = tx.Registrations.GetByTokenForUpdate(input.QRCodeToken); err != nil {
+			return errInvalidScanToken
+		}
+		return checkOutRegistration(tx.Registrations, &reg, time.Now())
+	})
+	if err != nil {
+		if err == errInvalidScanToken {
+			http.Error(w, "Invalid token", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, errNotCheckedIn) {
+			http.Error(w, "Not checked in", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Check-out failed", http.StatusInternalServerError)
+		return
+	}
+	s.publishRegistration(reg, "checked_out")
+
+	json.NewEncoder(w).Encode(reg)
+}
+
+type attendanceReport struct {
+	RegistrationID uuid.UUID           `json:"registration_id"`
+	UserID         uuid.UUID           `json:"user_id"`
+	UserUSN        string              `json:"user_usn"`
+	UserName       string              `json:"user_name"`
+	Status         string              `json:"status"`
+	FirstCheckIn   *time.Time          `json:"first_check_in"`
+	LastCheckOut   *time.Time          `json:"last_check_out"`
+	Inside         bool                `json:"inside"`
+	TotalSeconds   int64               `json:"total_seconds"`
+	Sessions       []AttendanceSession `json:"sessions"`
+}
+
+// handleEventAttendance reports how long each attendee spent at an event.
+// Open sessions count up to the time of the request. With min_minutes set,
+// only attendees who stayed at least that long are listed, which is what
+// clubs issue certificates from.
+func (s *Server) handleEventAttendance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.URL.Query().Get("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	minMinutes := 0
+	if raw := r.URL.Query().Get("min_minutes"); raw != "" {
+		minMinutes, err = strconv.Atoi(raw)
+		if err != nil || minMinutes < 0 {
+			http.Error(w, "Invalid min_minutes", http.StatusBadRequest)
+			return
+		}
+	}
+
+	regs, err := s.Registrations.ListAttended(eventID)
+	if err != nil {
+		http.Error(w, "Could not load attendance", http.StatusInternalServerError)
+		return
+	}
+
+	regIDs := make([]uuid.UUID, 0, len(regs))
+	for _, reg := range regs {
+		regIDs = append(regIDs, reg.ID)
+	}
+	sessions, _ := s.Registrations.Sessions(regIDs)
+	byReg := make(map[uuid.UUID][]AttendanceSession)
+	for _, session := range sessions {
+		byReg[session.RegistrationID] = append(byReg[session.RegistrationID], session)
+	}
+
+	now := time.Now()
+	reports := make([]attendanceReport, 0, len(regs))
+	for _, reg := range regs {
+		rep := attendanceReport{
+			RegistrationID: reg.ID,
+			UserID:         reg.UserID,
+			Status:         reg.Status,
+			FirstCheckIn:   reg.CheckedInAt,
+			LastCheckOut:   reg.CheckedOutAt,
+			Inside:         reg.Status == "checked_in",
+			Sessions:       byReg[reg.ID],
+		}
+		if rep.Sessions == nil {
+			rep.Sessions = []AttendanceSession{}
+		}
+		if reg.User != nil {
+			rep.UserUSN = reg.User.USN
+			rep.UserName = reg.User.Name
+		}
+
+		var total time.Duration
+		for _, session := range rep.Sessions {
+			end := now
+			if session.CheckedOutAt != nil {
+				end = *session.CheckedOutAt
+			}
+			if end.After(session.CheckedInAt) {
+				total += end.Sub(session.CheckedInAt)
+			}
+		}
+		rep.TotalSeconds = int64(total / time.Second)
+
+		if total < time.Duration(minMinutes)*time.Minute {
+			continue
+		}
+		reports = append(reports, rep)
+	}
+
+	json.NewEncoder(w).Encode(reports)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Hub room that receives check-in updates for every event.
+const allEventsStreamRoom = "checkins:all"
+
+func checkInStreamRoom(eventID uuid.UUID) string {
+	return "checkins:" + eventID.String()
+}
+
+type checkInStats struct {
+	Capacity   int   `json:"capacity"`
+	Registered int64 `json:"registered"` // Every registration that is neither cancelled nor waitlisted
+	CheckedIn  int64 `json:"checked_in"` // Attended at least once
+	Inside     int64 `json:"inside"`     // Currently checked in
+	CheckedOut int64 `json:"checked_out"`
+	// Waitlisted stays 0 until events have a waitlist; nothing gives a
+	// registration that status yet.
+	Waitlisted int64 `json:"waitlisted"`
+	Cancelled  int64 `json:"cancelled"`
+}
+
+type checkInUpdate struct {
+	Type    string       `json:"type"` // 'snapshot' on connect, 'update' afterwards
+	EventID uuid.UUID    `json:"event_id"`
+	Stats   checkInStats `json:"stats"`
+	Scan    *checkInScan `json:"scan,omitempty"`
+	At      time.Time    `json:"at"`
+}
+
+// checkInScan describes the registration change that triggered an update.
+type checkInScan struct {
+	Action  string `json:"action"` // 'registered', 'checked_in', 'checked_out', 'cancelled'
+	UserUSN string `json:"user_usn,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+func (s *Server) loadCheckInStats(eventID uuid.UUID) checkInStats {
+	var stats checkInStats
+
+	if event, err := s.Events.Get(eventID); err == nil {
+		stats.Capacity = event.Capacity
+	}
+
+	counts, _ := s.Registrations.StatusCounts(eventID)
+	for status, count := range counts {
+		switch status {
+		case "checked_in":
+			stats.Inside = count
+		case "checked_out":
+			stats.CheckedOut = count
+		case "waitlisted":
+			stats.Waitlisted = count
+		case "cancelled":
+			stats.Cancelled = count
+		}
+		if status != "cancelled" && status != "waitlisted" {
+			stats.Registered += count
+		}
+	}
+	stats.CheckedIn, _ = s.Registrations.CountCheckedIn(eventID)
+
+	return stats
+}
+
+// checkInChange is a queued publishCheckIn.
+type checkInChange struct {
+	EventID uuid.UUID
+	Scan    *checkInScan
+	At      time.Time
+}
+
+// publishCheckIn queues fresh stats for an event for its check-in stream and
+// the all-events stream. scan may be nil for changes not tied to one
+// attendee. It never blocks the scan: when the queue is full the update is
+// dropped, and the next one carries the stats anyway.
+func (s *Server) publishCheckIn(eventID uuid.UUID, scan *checkInScan) {
+	select {
+	case s.checkIns <- checkInChange{EventID: eventID, Scan: scan, At: time.Now()}:
+	default:
+		log.Printf("Check-in stream falling behind; dropped an update for event %s", eventID)
+	}
+}
+
+// runCheckInPublisher loads the stats for queued changes and hands them to
+// the hub, one at a time so dashboards see them in order, until ctx is
+// cancelled.
+func (s *Server) runCheckInPublisher(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-s.checkIns:
+			payload, err := json.Marshal(checkInUpdate{
+				Type:    "update",
+				EventID: change.EventID,
+				Stats:   s.loadCheckInStats(change.EventID),
+				Scan:    change.Scan,
+				At:      change.At,
+			})
+			if err != nil {
+				continue
+			}
+			s.hub.notify(Notification{Room: checkInStreamRoom(change.EventID), Payload: payload})
+			s.hub.notify(Notification{Room: allEventsStreamRoom, Payload: payload})
+		}
+	}
+}
+
+// publishRegistration reports a change to a single registration.
+func (s *Server) publishRegistration(reg Registration, action string) {
+	scan := &checkInScan{Action: action}
+	if reg.User != nil {
+		scan.UserUSN = reg.User.USN
+		scan.Name = reg.User.Name
+	}
+	s.publishCheckIn(reg.EventID, scan)
+}
+
+// handleCheckInStream streams live check-in stats to admins. Browsers cannot
+// set headers on a WebSocket handshake, so the JWT is passed as ?token=.
+// Without event_id the stream carries updates for every event.
+func (s *Server) handleCheckInStream(w http.ResponseWriter, r *http.Request) {
+	claims := s.parseToken(r.URL.Query().Get("token"))
+	if claims == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if claims["role"] != "admin" {
+		http.Error(w, "Forbidden: Admin access only", http.StatusForbidden)
+		return
+	}
+
+	room := allEventsStreamRoom
+	var eventIDs []uuid.UUID
+	if raw := r.URL.Query().Get("event_id"); raw != "" {
+		eventID, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+		room = checkInStreamRoom(eventID)
+		eventIDs = append(eventIDs, eventID)
+	} else {
+		eventIDs, _ = s.Events.IDs()
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Upgrade error:", err)
+		return
+	}
+
+	adminID, _ := claims["id"].(string)
+	client := &Client{
+		ID:   adminID,
+		Conn: conn,
+		Send: make(chan []byte, s.config.ClientSendBuffer),
+		Room: room,
+	}
+
+	for _, eventID := range eventIDs {
+		msgBytes, _ := json.Marshal(checkInUpdate{
+			Type:    "snapshot",
+			EventID: eventID,
+			Stats:   s.loadCheckInStats(eventID),
+			At:      time.Now(),
+		})
+		client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+	}
+
+	if !s.hub.register(client) {
+		conn.Close()
+		return
+	}
+
+	// The stream is one-way; reading only detects the client going away.
+	go func() {
+		defer func() {
+			s.hub.unregister(client)
+			conn.Close()
+		}()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}()
+
+	go func() {
+		for message := range client.Send {
+			client.Conn.WriteMessage(websocket.TextMessage, message)
+		}
+	}()
+}
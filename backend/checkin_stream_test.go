@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLoadCheckInStats(t *testing.T) {
+	stores := newMemoryStores()
+	event := Event{Title: "Hackathon", EventDate: time.Now(), Capacity: 10}
+	if err := stores.Events.Create(&event); err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range []string{"registered", "registered", "checked_in", "checked_out", "waitlisted", "cancelled"} {
+		user := User{USN: fmt.Sprintf("1JS21CS%03d", i+1), Role: "student"}
+		if err := stores.Users.Create(&user); err != nil {
+			t.Fatal(err)
+		}
+		reg := Registration{EventID: event.ID, UserID: user.ID, QRCodeToken: uuid.NewString(), Status: status}
+		if err := stores.Registrations.Create(&reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newServer(defaultConfig(), stores, newHub(), nil)
+	got := s.loadCheckInStats(event.ID)
+	want := checkInStats{Capacity: 10, Registered: 4, Inside: 1, CheckedOut: 1, Waitlisted: 1, Cancelled: 1}
+	if got != want {
+		t.Errorf("stats %+v, want %+v", got, want)
+	}
+
+	// Dashboards read all the requested counts, waitlisted included.
+	data, _ := json.Marshal(checkInStats{})
+	for _, key := range []string{`"registered":0`, `"checked_in":0`, `"waitlisted":0`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("%s lacks %s", data, key)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scanner clocks drift; scans stamped further than this into the future are rejected.
+const maxScanClockSkew = 5 * time.Minute
+
+// Outcomes reported for each offline scan.
+const (
+	scanCheckedIn        = "checked_in"
+	scanDuplicate        = "duplicate"
+	scanAlreadyCheckedIn = "already_checked_in"
+	scanInvalidToken     = "invalid_token"
+	scanWrongEvent       = "wrong_event"
+	scanCancelled        = "cancelled"
+	scanInvalidTimestamp = "invalid_timestamp"
+)
+
+type checkInTokenExport struct {
+	RegistrationID uuid.UUID `json:"registration_id"`
+	QRCodeToken    string    `json:"qr_code_token"`
+	UserUSN        string    `json:"user_usn"`
+	UserName       string    `json:"user_name"`
+	Status         string    `json:"status"`
+}
+
+type offlineScan struct {
+	QRCodeToken string    `json:"qr_code_token"`
+	ScannedAt   time.Time `json:"scanned_at"`
+	DeviceID    string    `json:"device_id"`
+}
+
+type offlineScanResult struct {
+	offlineScan
+	RegistrationID *uuid.UUID `json:"registration_id,omitempty"`
+	Result         string     `json:"result"`
+	CheckedInAt    *time.Time `json:"checked_in_at,omitempty"`
+}
+
+// handleCheckInTokens exports every valid check-in token of an event so a
+// scanner device can verify tickets while offline.
+func (s *Server) handleCheckInTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.URL.Query().Get("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	regs, _ := s.Registrations.ListActiveForEvent(eventID)
+
+	tokens := make([]checkInTokenExport, 0, len(regs))
+	for _, reg := range regs {
+		t := checkInTokenExport{
+			RegistrationID: reg.ID,
+			QRCodeToken:    reg.QRCodeToken,
+			Status:         reg.Status,
+		}
+		if reg.User != nil {
+			t.UserUSN = reg.User.USN
+			t.UserName = reg.User.Name
+		}
+		tokens = append(tokens, t)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"event_id":     eventID,
+		"generated_at": time.Now(),
+		"tokens":       tokens,
+	})
+}
+
+// handleCheckInSync applies a batch of scans recorded offline. Scans are
+// processed in (scanned_at, qr_code_token, device_id) order so that replaying
+// the same batch always yields the same outcome: the earliest scan of a token
+// wins and becomes its check-in time, and every other scan is reported back
+// as a conflict.
+func (s *Server) handleCheckInSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		EventID uuid.UUID     `json:"event_id"`
+		Scans   []offlineScan `json:"scans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if input.EventID == uuid.Nil {
+		http.Error(w, "event_id is required", http.StatusBadRequest)
+		return
+	}
+
+	scans := input.Scans
+	sort.SliceStable(scans, func(i, j int) bool {
+		a, b := scans[i], scans[j]
+		if !a.ScannedAt.Equal(b.ScannedAt) {
+			return a.ScannedAt.Before(b.ScannedAt)
+		}
+		if a.QRCodeToken != b.QRCodeToken {
+			return a.QRCodeToken < b.QRCodeToken
+		}
+		return a.DeviceID < b.DeviceID
+	})
+
+	results := make([]offlineScanResult, 0, len(scans))
+	applied := 0
+	latest := time.Now().Add(maxScanClockSkew)
+
+	err := s.Transaction(func(tx Stores) error {
+		seen := make(map[string]bool)
+		for _, scan := range scans {
+			res := offlineScanResult{offlineScan: scan}
+			results = append(results, res)
+			out := &results[len(results)-1]
+
+			if scan.ScannedAt.IsZero() || scan.ScannedAt.After(latest) {
+				out.Result = scanInvalidTimestamp
+				continue
+			}
+
+			reg, err := tx.Registrations.GetByTokenForUpdate(scan.QRCodeToken)
+			if err != nil {
+				out.Result = scanInvalidToken
+				continue
+			}
+			out.RegistrationID = &reg.ID
+
+			// A scan after the last check-out is the attendee coming back,
+			// which opens a new attendance session.
+			reentry := reg.Status == "checked_out" && reg.CheckedOutAt != nil && scan.ScannedAt.After(*reg.CheckedOutAt)
+
+			switch {
+			case reg.EventID != input.EventID:
+				out.Result = scanWrongEvent
+			case reg.Status == "cancelled":
+				out.Result = scanCancelled
+			case seen[scan.QRCodeToken]:
+				out.Result = scanDuplicate
+				out.CheckedInAt = reg.CheckedInAt
+			case reg.CheckedInAt != nil && !reentry:
+				// Inside, or during a visit recorded online; keep whichever
+				// entry came first.
+				out.Result = scanAlreadyCheckedIn
+				if scan.ScannedAt.Before(*reg.CheckedInAt) {
+					if err := tx.Registrations.BackdateCheckIn(&reg, scan.ScannedAt); err != nil {
+						return err
+					}
+				}
+				out.CheckedInAt = reg.CheckedInAt
+			default:
+				at := scan.ScannedAt
+				if err := tx.Registrations.CheckIn(&reg, at); err != nil {
+					return err
+				}
+				out.Result = scanCheckedIn
+				out.CheckedInAt = &at
+				applied++
+			}
+			seen[scan.QRCodeToken] = true
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Sync failed", http.StatusInternalServerError)
+		return
+	}
+	if applied > 0 {
+		s.publishCheckIn(input.EventID, nil)
+	}
+
+	conflicts := make([]offlineScanResult, 0)
+	for _, res := range results {
+		if res.Result != scanCheckedIn {
+			conflicts = append(conflicts, res)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"event_id":  input.EventID,
+		"applied":   applied,
+		"results":   results,
+		"conflicts": conflicts,
+	})
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is everything the server can be tuned with. loadConfig fills it
+// from, in increasing precedence, the defaults, a KEY=value config file
+// (.env unless -config says otherwise), the environment and flags.
+type Config struct {
+	Port                string
+	DBDriver            string
+	DatabaseURL         string
+	JWTSecret           string
+	RoomCleanupInterval time.Duration
+	ClientSendBuffer    int
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	LongWriteTimeout    time.Duration // Replaces WriteTimeout for exports, QR codes and images
+	IdleTimeout         time.Duration
+	ShutdownTimeout     time.Duration
+	Location            *time.Location // Event days and datetime-local input are in this zone
+
+	StorageBackend string
+	UploadDir      string
+	UploadBaseURL  string
+	S3             S3Config
+}
+
+// defaultLocation is where the college is. time/tzdata keeps it loadable on
+// hosts without a zoneinfo database.
+var defaultLocation, _ = time.LoadLocation("Asia/Kolkata")
+
+func defaultConfig() Config {
+	return Config{
+		Port:                "8080",
+		DBDriver:            "postgres",
+		RoomCleanupInterval: time.Minute,
+		ClientSendBuffer:    256,
+		ReadTimeout:         time.Minute,
+		WriteTimeout:        time.Minute,
+		LongWriteTimeout:    15 * time.Minute,
+		IdleTimeout:         2 * time.Minute,
+		ShutdownTimeout:     15 * time.Second,
+		Location:            defaultLocation,
+		StorageBackend:      "local",
+		UploadDir:           "uploads",
+		S3:                  S3Config{UseSSL: true},
+	}
+}
+
+// setting ties a Config field to its environment variable (also its key in
+// the config file) and its flag.
+type setting struct {
+	env, flag, usage string
+	value            flag.Value
+	secret           bool
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"PORT", "port", "HTTP listen port", (*stringValue)(&c.Port), false},
+		{"DB_DRIVER", "db-driver", "database driver: postgres or sqlite", (*stringValue)(&c.DBDriver), false},
+		{"DATABASE_URL", "database-url", "database DSN, or file name for sqlite (default jssrooms.db)", (*stringValue)(&c.DatabaseURL), true},
+		{"JWT_SECRET", "jwt-secret", "key used to sign login tokens", (*stringValue)(&c.JWTSecret), true},
+		{"ROOM_CLEANUP_INTERVAL", "room-cleanup-interval", "how often expired rooms are closed", (*durationValue)(&c.RoomCleanupInterval), false},
+		{"CLIENT_SEND_BUFFER", "client-send-buffer", "messages queued per WebSocket client before it is dropped", (*intValue)(&c.ClientSendBuffer), false},
+		{"HTTP_READ_TIMEOUT", "http-read-timeout", "limit for reading a whole request, body included", (*durationValue)(&c.ReadTimeout), false},
+		{"HTTP_WRITE_TIMEOUT", "http-write-timeout", "limit for writing a response", (*durationValue)(&c.WriteTimeout), false},
+		{"HTTP_LONG_WRITE_TIMEOUT", "http-long-write-timeout", "limit for writing exports, QR codes, image uploads and uploaded files", (*durationValue)(&c.LongWriteTimeout), false},
+		{"HTTP_IDLE_TIMEOUT", "http-idle-timeout", "how long idle keep-alive connections stay open", (*durationValue)(&c.IdleTimeout), false},
+		{"TIMEZONE", "timezone", "IANA zone that decides which day an event falls on", locationValue{&c.Location}, false},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long to wait for in-flight requests on SIGINT/SIGTERM", (*durationValue)(&c.ShutdownTimeout), false},
+		{"STORAGE_BACKEND", "storage-backend", "upload storage: local or s3", (*stringValue)(&c.StorageBackend), false},
+		{"UPLOAD_DIR", "upload-dir", "directory for local uploads", (*stringValue)(&c.UploadDir), false},
+		{"UPLOAD_BASE_URL", "upload-base-url", "public URL prefix for local uploads", (*stringValue)(&c.UploadBaseURL), false},
+		{"S3_ENDPOINT", "s3-endpoint", "S3 endpoint host", (*stringValue)(&c.S3.Endpoint), false},
+		{"S3_REGION", "s3-region", "S3 region", (*stringValue)(&c.S3.Region), false},
+		{"S3_BUCKET", "s3-bucket", "S3 bucket", (*stringValue)(&c.S3.Bucket), false},
+		{"S3_ACCESS_KEY", "s3-access-key", "S3 access key", (*stringValue)(&c.S3.AccessKey), true},
+		{"S3_SECRET_KEY", "s3-secret-key", "S3 secret key", (*stringValue)(&c.S3.SecretKey), true},
+		{"S3_USE_SSL", "s3-use-ssl", "connect to S3 over TLS", (*boolValue)(&c.S3.UseSSL), false},
+		{"S3_PUBLIC_URL", "s3-public-url", "public URL prefix for S3 objects", (*stringValue)(&c.S3.PublicURL), false},
+	}
+}
+
+// loadConfig builds the configuration from args, the server's command line.
+// It reports whether -print-config was given; the result is not validated.
+func loadConfig(args []string) (cfg Config, printConfig bool, err error) {
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	fs.BoolVar(&printConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	flags := configFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return defaultConfig(), false, err
+	}
+	cfg, err = flags.load()
+	return cfg, printConfig, err
+}
+
+// configFlagSet holds the configuration flags registered on a command's
+// flag set, so subcommands take the same -config and setting flags.
+type configFlagSet struct {
+	fs       *flag.FlagSet
+	cfg      *Config
+	settings []setting
+	path     *string
+}
+
+// configFlags registers -config and a flag per setting on fs. Call load
+// once fs has been parsed.
+func configFlags(fs *flag.FlagSet) *configFlagSet {
+	cfg := defaultConfig()
+	c := &configFlagSet{fs: fs, cfg: &cfg, settings: cfg.settings()}
+	c.path = fs.String("config", "", "KEY=value config file (default .env, if present)")
+	for _, s := range c.settings {
+		fs.Var(s.value, s.flag, s.usage+" ($"+s.env+")")
+	}
+	return c
+}
+
+// load layers the config file and the environment over the defaults, then
+// the parsed flags over those.
+func (c *configFlagSet) load() (Config, error) {
+	// Parsing already stored the flags, so note them to apply again last.
+	flags := map[string]string{}
+	c.fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+
+	var file map[string]string
+	var err error
+	path := *c.path
+	if path != "" {
+		if file, err = godotenv.Read(path); err != nil {
+			return *c.cfg, err
+		}
+	} else if file, err = godotenv.Read(".env"); err == nil {
+		path = ".env"
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return *c.cfg, err
+	}
+
+	for _, s := range c.settings {
+		if v := file[s.env]; v != "" {
+			if err := s.value.Set(v); err != nil {
+				return *c.cfg, fmt.Errorf("%s in %s: %w", s.env, path, err)
+			}
+		}
+		if v := os.Getenv(s.env); v != "" {
+			if err := s.value.Set(v); err != nil {
+				return *c.cfg, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+		if v, ok := flags[s.flag]; ok {
+			s.value.Set(v)
+		}
+	}
+	if c.cfg.DBDriver == "sqlite" && c.cfg.DatabaseURL == "" {
+		c.cfg.DatabaseURL = "jssrooms.db"
+	}
+	return *c.cfg, nil
+}
+
+// validateDatabase checks the settings openDB needs; the import and migrate
+// commands need no more than that.
+func (c Config) validateDatabase() error {
+	switch c.DBDriver {
+	case "postgres":
+		if c.DatabaseURL == "" {
+			return errors.New("DATABASE_URL is not set")
+		}
+	case "sqlite":
+	default:
+		return fmt.Errorf("unknown DB_DRIVER %q", c.DBDriver)
+	}
+	return nil
+}
+
+// placeholderSecrets are example JWT secrets, such as the one the old
+// checked-in .env shipped with, that must never sign real tokens.
+var placeholderSecrets = map[string]bool{
+	"your_super_secret_key_here": true,
+	"your-super-secret-key-here": true,
+	"your-secret-key":            true,
+	"your_secret_key":            true,
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	if err := c.validateDatabase(); err != nil {
+		errs = append(errs, err)
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %q is not a port number", c.Port))
+	}
+	if placeholderSecrets[strings.ToLower(c.JWTSecret)] {
+		errs = append(errs, errors.New("JWT_SECRET is an example value; generate a random one"))
+	} else if len(c.JWTSecret) < 16 {
+		errs = append(errs, errors.New("JWT_SECRET must be at least 16 characters"))
+	}
+	if c.RoomCleanupInterval <= 0 {
+		errs = append(errs, errors.New("ROOM_CLEANUP_INTERVAL must be positive"))
+	}
+	if c.ClientSendBuffer < 1 {
+		errs = append(errs, errors.New("CLIENT_SEND_BUFFER must be at least 1"))
+	}
+	for _, d := range []struct {
+		env   string
+		value time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout},
+		{"HTTP_LONG_WRITE_TIMEOUT", c.LongWriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.env))
+		}
+	}
+	switch c.StorageBackend {
+	case "local":
+		if c.UploadDir == "" {
+			errs = append(errs, errors.New("UPLOAD_DIR is not set"))
+		}
+	case "s3":
+		if c.S3.Endpoint == "" || c.S3.Bucket == "" {
+			errs = append(errs, errors.New("S3_ENDPOINT and S3_BUCKET are required for s3 storage"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown STORAGE_BACKEND %q", c.StorageBackend))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as a config file would have it, with
+// secrets redacted.
+func (c Config) Print(w io.Writer) {
+	for _, s := range c.settings() {
+		value := s.value.String()
+		if s.secret && value != "" {
+			value = redacted(s.env, value)
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.env, value)
+	}
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redacted hides a secret, keeping what is harmless in a DSN so the
+// printout still shows which database is used.
+func redacted(env, value string) string {
+	if env != "DATABASE_URL" {
+		return "[redacted]"
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(value, "${1}xxxxx")
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.New("not a boolean")
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("not a duration, e.g. 30s or 5m")
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type locationValue struct{ loc **time.Location }
+
+func (v locationValue) Set(s string) error {
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return errors.New("not an IANA time zone, e.g. Asia/Kolkata")
+	}
+	*v.loc = loc
+	return nil
+}
+
+func (v locationValue) String() string {
+	if v.loc == nil || *v.loc == nil {
+		return ""
+	}
+	return (*v.loc).String()
+}
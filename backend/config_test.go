@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestValidateJWTSecret(t *testing.T) {
+	for secret, want := range map[string]string{
+		"":                            "at least 16 characters",
+		"short":                       "at least 16 characters",
+		"your-secret-key":             "example value",
+		"your_super_secret_key_here":  "example value",
+		"YOUR_SUPER_SECRET_KEY_HERE":  "example value",
+		"k3Jx9qLm2VbT7wRz5NcY8pHd4Fs": "",
+	} {
+		cfg := defaultConfig()
+		cfg.DatabaseURL = "host=localhost"
+		cfg.JWTSecret = secret
+		err := cfg.Validate()
+		if want == "" && err != nil {
+			t.Errorf("%q: %v", secret, err)
+		}
+		if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%q: error %v, want %q", secret, err, want)
+		}
+	}
+}
+
+// TestConfigFlagsOnSubcommand checks that subcommands take the config flags
+// alongside their own, with flags beating the environment.
+func TestConfigFlagsOnSubcommand(t *testing.T) {
+	t.Chdir(t.TempDir()) // No .env
+	t.Setenv("DB_DRIVER", "postgres")
+	t.Setenv("DATABASE_URL", "host=db")
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	kind := fs.String("kind", "", "")
+	config := configFlags(fs)
+	if err := fs.Parse([]string{"-kind", "events", "-db-driver", "sqlite", "-database-url", "import.db", "rows.json"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *kind != "events" || fs.Arg(0) != "rows.json" {
+		t.Errorf("subcommand flags: kind %q, args %v", *kind, fs.Args())
+	}
+	if cfg.DBDriver != "sqlite" || cfg.DatabaseURL != "import.db" {
+		t.Errorf("config %s %q, want sqlite import.db", cfg.DBDriver, cfg.DatabaseURL)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// registrationExportHeader names the columns; the time columns say which
+// zone their values are in.
+func registrationExportHeader(loc *time.Location) []string {
+	zone := " (" + loc.String() + ")"
+	return []string{
+		"Registration ID", "USN", "Name", "Groups", "Status", "Registered At" + zone, "Checked In At" + zone, "Checked Out At" + zone,
+	}
+}
+
+// rowWriter receives export rows one at a time so nothing is buffered beyond
+// the row being written.
+type rowWriter interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+// handleEventExport streams an event's registrations joined with their users
+// as CSV (default) or XLSX, selected by ?format=.
+func (s *Server) handleEventExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.URL.Query().Get("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	event, err := s.Events.Get(eventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	// The response starts with the first row, so a failing query can still
+	// be reported as an error.
+	var out rowWriter
+	start := func() error {
+		filename := fmt.Sprintf("%s-registrations.%s", exportSlug(event.Title), format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		if format == "xlsx" {
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			xw, err := newXLSXWriter(w, "Registrations")
+			if err != nil {
+				return err
+			}
+			out = xw
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			out = newCSVWriter(w)
+		}
+		return out.WriteRow(registrationExportHeader(s.config.Location))
+	}
+
+	// Headers are already sent once out is set, so failures can only cut the
+	// file short.
+	err = s.Registrations.Export(eventID, func(row RegistrationExportRow) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return out.WriteRow([]string{
+			row.ID.String(), spreadsheetSafe(row.USN), spreadsheetSafe(row.Name), spreadsheetSafe(row.Groups), row.Status,
+			formatExportTime(&row.CreatedAt, s.config.Location), formatExportTime(row.CheckedInAt, s.config.Location), formatExportTime(row.CheckedOutAt, s.config.Location),
+		})
+	})
+	if out == nil {
+		if err != nil {
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+			return
+		}
+		if start() != nil {
+			return
+		}
+	}
+	if err != nil {
+		return
+	}
+	out.Close()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// spreadsheetSafe defuses user-entered text that a spreadsheet would run as a
+// formula (CSV injection) by prefixing it with a quote, as OWASP recommends.
+func spreadsheetSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// formatExportTime writes t in loc, whatever zone the database driver
+// returned it in; nil is an empty cell.
+func formatExportTime(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format(exportTimeLayout)
+}
+
+// exportSlug turns an event title into a safe file name stem.
+func exportSlug(title string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, title)
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		return "event"
+	}
+	return slug
+}
+
+type csvRowWriter struct {
+	w *csv.Writer
+	n int
+}
+
+func newCSVWriter(w io.Writer) *csvRowWriter {
+	return &csvRowWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvRowWriter) WriteRow(cells []string) error {
+	if err := c.w.Write(cells); err != nil {
+		return err
+	}
+	c.n++
+	if c.n%500 == 0 {
+		c.w.Flush()
+	}
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsxRowWriter writes a single-sheet workbook straight into a zip stream.
+// Cells are inline strings, so no shared-strings table has to be held in
+// memory until the end.
+type xlsxRowWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+func newXLSXWriter(w io.Writer, sheetName string) (*xlsxRowWriter, error) {
+	zw := zip.NewWriter(w)
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName))
+
+	parts := []struct{ path, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet is the last entry, so it can stay open while rows stream in.
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return &xlsxRowWriter{zw: zw, sheet: sheet}, nil
+}
+
+func (x *xlsxRowWriter) WriteRow(cells []string) error {
+	x.row++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		fmt.Fprintf(x.sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumn(i), x.row)
+		if err := xml.EscapeText(x.sheet, []byte(cell)); err != nil {
+			return err
+		}
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxRowWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumn converts a zero-based column index to its spreadsheet letters (0 -> A, 26 -> AA).
+func xlsxColumn(i int) string {
+	col := ""
+	for i >= 0 {
+		col = string(rune('A'+i%26)) + col
+		i = i/26 - 1
+	}
+	return col
+}
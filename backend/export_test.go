@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSpreadsheetSafe(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                "",
+		"Asha Rao":        "Asha Rao",
+		"1JS21CS001":      "1JS21CS001",
+		"=1+2":            "'=1+2",
+		"+91 98450 00000": "'+91 98450 00000",
+		"-2+3":            "'-2+3",
+		"@SUM(A1:A2)":     "'@SUM(A1:A2)",
+		"\t=cmd":          "'\t=cmd",
+		"\r=cmd":          "'\r=cmd",
+		"Rao, Asha =1+2":  "Rao, Asha =1+2",
+		"'already quoted": "'already quoted",
+	} {
+		if got := spreadsheetSafe(in); got != want {
+			t.Errorf("spreadsheetSafe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestExportTimesInConfiguredZone checks that exported times are in the
+// configured zone, named in the header, whatever zone the store returns.
+func TestExportTimesInConfiguredZone(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		user := ts.register("1JS21CS001", "")
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{
+			"title": "Hackathon", "event_date": time.Now().Add(time.Hour),
+		}, &event)
+		var reg, scanned Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", user.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin", admin.Token, map[string]interface{}{"qr_code_token": reg.QRCodeToken}, &scanned)
+
+		resp, body := ts.get("/api/events/export?event_id="+event.ID.String(), admin.Token)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("export: status %d: %s", resp.StatusCode, body)
+		}
+		records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+		if err != nil || len(records) != 2 {
+			t.Fatalf("export %q, %v", body, err)
+		}
+		header, row := records[0], records[1]
+		if header[5] != "Registered At (Asia/Kolkata)" || header[6] != "Checked In At (Asia/Kolkata)" {
+			t.Errorf("header %q", header)
+		}
+		ist, _ := time.LoadLocation("Asia/Kolkata")
+		if want := scanned.CheckedInAt.In(ist).Format(exportTimeLayout); row[6] != want {
+			t.Errorf("checked in at %q, want %q", row[6], want)
+		}
+		if row[7] != "" {
+			t.Errorf("checked out at %q, want empty", row[7])
+		}
+	})
+}
+
+// TestExportDoesNotBlockOtherQueries runs a query from inside the export
+// callback, which stands in for a slow client: it must not have to wait
+// for the export to finish.
+func TestExportDoesNotBlockOtherQueries(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			stores := backend.stores(t)
+			event := Event{Title: "Hackathon", EventDate: time.Now()}
+			if err := stores.Events.Create(&event); err != nil {
+				t.Fatal(err)
+			}
+			for _, usn := range []string{"1JS21CS001", "1JS21CS002"} {
+				user := User{USN: usn, Role: "student"}
+				if err := stores.Users.Create(&user); err != nil {
+					t.Fatal(err)
+				}
+				reg := Registration{EventID: event.ID, UserID: user.ID, QRCodeToken: uuid.NewString()}
+				if err := stores.Registrations.Create(&reg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rows := 0
+			err := stores.Registrations.Export(event.ID, func(RegistrationExportRow) error {
+				rows++
+				done := make(chan error, 1)
+				go func() {
+					_, err := stores.Events.Get(event.ID)
+					done <- err
+				}()
+				select {
+				case err := <-done:
+					return err
+				case <-time.After(5 * time.Second):
+					return errors.New("query blocked behind the export")
+				}
+			})
+			if err != nil || rows != 2 {
+				t.Errorf("exported %d rows, %v", rows, err)
+			}
+		})
+	}
+}
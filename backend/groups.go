@@ -0,0 +1,487 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func validJoinPolicy(policy string) bool {
+	switch policy {
+	case "", "open", "approval", "invite":
+		return true
+	}
+	return false
+}
+
+func validMemberRole(role string) bool {
+	return role == "owner" || role == "manager" || role == "member"
+}
+
+// groupRole returns the user's role in the group, or "" if not a member.
+func groupRole(groups GroupStore, userID, groupID uuid.UUID) string {
+	m, err := groups.Membership(userID, groupID)
+	if err != nil {
+		return ""
+	}
+	return m.Role
+}
+
+// isGroupMember reports whether the user belongs to the group.
+func isGroupMember(groups GroupStore, userID, groupID uuid.UUID) bool {
+	return groupRole(groups, userID, groupID) != ""
+}
+
+// canManageGroup reports whether the caller is an admin or the group's owner
+// or one of its managers.
+func (s *Server) canManageGroup(r *http.Request, group Group) bool {
+	if s.getRoleFromToken(r) == "admin" {
+		return true
+	}
+	role := groupRole(s.Groups, s.getUserIDFromToken(r), group.ID)
+	return role == "owner" || role == "manager"
+}
+
+// migrateGroupMemberships moves the old single users.group_id link into
+// group_memberships and drops the column. Group owners get the owner role.
+func migrateGroupMemberships(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&User{}, "group_id") {
+		return nil
+	}
+
+	var links []struct {
+		ID      uuid.UUID
+		GroupID uuid.UUID
+	}
+	if err := db.Table("users").Select("id, group_id").Where("group_id IS NOT NULL").Scan(&links).Error; err != nil {
+		return fmt.Errorf("reading group links: %w", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		groups := gormGroupStore{tx}
+		for _, link := range links {
+			if err := tx.Select("id").First(&Group{}, "id = ?", link.GroupID).Error; err != nil {
+				continue // Dangling link to a deleted group
+			}
+			if err := groups.AddMember(link.ID, link.GroupID, "member"); err != nil {
+				return err
+			}
+		}
+		var owned []Group
+		tx.Where("owner_id IS NOT NULL").Find(&owned)
+		for _, g := range owned {
+			if err := groups.AddMember(*g.OwnerID, g.ID, "owner"); err != nil {
+				return err
+			}
+			if err := groups.SetRole(*g.OwnerID, g.ID, "owner"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&User{}, "group_id")
+	})
+	if err != nil {
+		return fmt.Errorf("migrating group memberships: %w", err)
+	}
+	log.Printf("Migrated %d group memberships", len(links))
+	return nil
+}
+
+// loadGroup fetches the group named by the {id} path segment, writing the
+// error response itself when that fails.
+func (s *Server) loadGroup(w http.ResponseWriter, r *http.Request) (Group, bool) {
+	groupID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return Group{}, false
+	}
+	group, err := s.Groups.Get(groupID)
+	if err != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return group, false
+	}
+	return group, true
+}
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// handleGroup serves GET, PUT and DELETE on /api/groups/{id}.
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(group)
+		return
+	}
+
+	if !s.canManageGroup(r, group) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var input struct {
+			Name        *string    `json:"name"`
+			Description *string    `json:"description"`
+			JoinPolicy  *string    `json:"join_policy"`
+			OwnerID     *uuid.UUID `json:"owner_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+
+		previousOwner := group.OwnerID
+		if input.Name != nil {
+			if *input.Name == "" {
+				http.Error(w, "name is required", http.StatusBadRequest)
+				return
+			}
+			group.Name = *input.Name
+		}
+		if input.Description != nil {
+			group.Description = *input.Description
+		}
+		if input.JoinPolicy != nil {
+			if *input.JoinPolicy == "" || !validJoinPolicy(*input.JoinPolicy) {
+				http.Error(w, "join_policy must be 'open', 'approval' or 'invite'", http.StatusBadRequest)
+				return
+			}
+			group.JoinPolicy = *input.JoinPolicy
+		}
+		if input.OwnerID != nil {
+			// Ownership can only be handed to someone already in the group.
+			if !isGroupMember(s.Groups, *input.OwnerID, group.ID) {
+				http.Error(w, "New owner must be a group member", http.StatusBadRequest)
+				return
+			}
+			group.OwnerID = input.OwnerID
+		}
+
+		err := s.Transaction(func(tx Stores) error {
+			if err := tx.Groups.Save(&group); err != nil {
+				return err
+			}
+			if input.OwnerID == nil || (previousOwner != nil && *previousOwner == *input.OwnerID) {
+				return nil
+			}
+			// The previous owner stays on as a manager.
+			if previousOwner != nil {
+				if err := tx.Groups.SetRole(*previousOwner, group.ID, "manager"); err != nil {
+					return err
+				}
+			}
+			return tx.Groups.SetRole(*input.OwnerID, group.ID, "owner")
+		})
+		if err != nil {
+			http.Error(w, "Update failed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(group)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		// Dropping the link would silently open members-only events to everyone.
+		restricted, err := s.Groups.RestrictsContent(group.ID)
+		if err != nil {
+			http.Error(w, "Delete failed", http.StatusInternalServerError)
+			return
+		}
+		if restricted {
+			http.Error(w, "Group still restricts events or activities", http.StatusConflict)
+			return
+		}
+
+		err = s.Transaction(func(tx Stores) error {
+			// Rooms restricted to the group must not silently become public.
+			if err := tx.Rooms.CloseForGroup(group.ID); err != nil {
+				return err
+			}
+			return tx.Groups.Delete(group.ID)
+		})
+		if err != nil {
+			http.Error(w, "Delete failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// handleGroupMembers lists a group's members to its members and managers.
+func (s *Server) handleGroupMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !s.canManageGroup(r, group) && !isGroupMember(s.Groups, s.getUserIDFromToken(r), group.ID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	members, _ := s.Groups.Members(group.ID)
+	if members == nil {
+		members = []GroupMembership{}
+	}
+	json.NewEncoder(w).Encode(members)
+}
+
+// handleGroupMember changes a member's role (PUT) or removes them (DELETE).
+// Managers can remove anyone but the owner and members can remove themselves
+// to leave the group; only the owner and admins can change roles.
+func (s *Server) handleGroupMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	callerID := s.getUserIDFromToken(r)
+
+	membership, err := s.Groups.Membership(memberID, group.ID)
+	if err != nil {
+		http.Error(w, "Not a member of this group", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if s.getRoleFromToken(r) != "admin" && groupRole(s.Groups, callerID, group.ID) != "owner" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || !validMemberRole(input.Role) {
+			http.Error(w, "role must be 'manager' or 'member'", http.StatusBadRequest)
+			return
+		}
+		// Ownership moves through the group's owner_id so there is always one owner.
+		if input.Role == "owner" || membership.Role == "owner" {
+			http.Error(w, "Transfer ownership by updating the group's owner_id", http.StatusConflict)
+			return
+		}
+		if err := s.Groups.SetRole(memberID, group.ID, input.Role); err != nil {
+			http.Error(w, "Could not update member", http.StatusInternalServerError)
+			return
+		}
+		membership.Role = input.Role
+		json.NewEncoder(w).Encode(membership)
+		return
+	}
+
+	if memberID != callerID && !s.canManageGroup(r, group) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if membership.Role == "owner" {
+		http.Error(w, "Transfer ownership before removing the owner", http.StatusConflict)
+		return
+	}
+
+	if err := s.Groups.RemoveMember(memberID, group.ID); err != nil {
+		http.Error(w, "Could not remove member", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGroupJoin lets the caller join according to the group's policy:
+// 'open' groups admit immediately, 'invite' groups need the invite code and
+// 'approval' groups queue a request for the owner, unless a valid invite
+// code is presented.
+func (s *Server) handleGroupJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	userID := s.getUserIDFromToken(r)
+	if userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		InviteCode string `json:"invite_code"`
+	}
+	// The body is optional for open and approval groups.
+	json.NewDecoder(r.Body).Decode(&input)
+
+	if isGroupMember(s.Groups, userID, group.ID) {
+		http.Error(w, "Already a member", http.StatusConflict)
+		return
+	}
+
+	validCode := input.InviteCode != "" && group.InviteCode != nil && input.InviteCode == *group.InviteCode
+	if group.JoinPolicy == "invite" && !validCode {
+		http.Error(w, "A valid invite code is required", http.StatusForbidden)
+		return
+	}
+
+	if group.JoinPolicy == "open" || validCode {
+		if err := s.Groups.AddMember(userID, group.ID, "member"); err != nil {
+			http.Error(w, "Could not join group", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "joined"})
+		return
+	}
+
+	if _, err := s.Groups.PendingRequest(group.ID, userID); err == nil {
+		http.Error(w, "Join request already pending", http.StatusConflict)
+		return
+	}
+	req := GroupJoinRequest{GroupID: group.ID, UserID: userID, Status: "pending"}
+	if err := s.Groups.CreateRequest(&req); err != nil {
+		http.Error(w, "Could not request to join", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "pending", "request": req})
+}
+
+// handleGroupJoinRequests lists pending join requests to group managers.
+func (s *Server) handleGroupJoinRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !s.canManageGroup(r, group) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	requests, _ := s.Groups.PendingRequests(group.ID)
+	if requests == nil {
+		requests = []GroupJoinRequest{}
+	}
+	json.NewEncoder(w).Encode(requests)
+}
+
+// handleGroupJoinDecision approves or rejects a pending join request.
+func (s *Server) handleGroupJoinDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !s.canManageGroup(r, group) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Decision string `json:"decision"` // 'approve' or 'reject'
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || (input.Decision != "approve" && input.Decision != "reject") {
+		http.Error(w, "decision must be 'approve' or 'reject'", http.StatusBadRequest)
+		return
+	}
+
+	requestID, _ := uuid.Parse(r.PathValue("requestId"))
+	req, err := s.Groups.GetRequest(group.ID, requestID)
+	if err != nil {
+		http.Error(w, "Join request not found", http.StatusNotFound)
+		return
+	}
+	if req.Status != "pending" {
+		http.Error(w, "Join request already decided", http.StatusConflict)
+		return
+	}
+
+	deciderID := s.getUserIDFromToken(r)
+	now := time.Now()
+	status := "rejected"
+	if input.Decision == "approve" {
+		status = "approved"
+	}
+
+	req.Status = status
+	req.DecidedBy = &deciderID
+	req.DecidedAt = &now
+	err = s.Transaction(func(tx Stores) error {
+		if status == "approved" {
+			if err := tx.Groups.AddMember(req.UserID, group.ID, "member"); err != nil {
+				return err
+			}
+		}
+		return tx.Groups.SaveRequest(&req)
+	})
+	if err != nil {
+		http.Error(w, "Could not record decision", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(req)
+}
+
+// handleGroupInviteCode shows (GET) or rotates (POST) the group's invite code.
+func (s *Server) handleGroupInviteCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := s.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !s.canManageGroup(r, group) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if group.InviteCode == nil || r.Method == http.MethodPost {
+		code, err := newInviteCode()
+		if err != nil {
+			http.Error(w, "Could not generate invite code", http.StatusInternalServerError)
+			return
+		}
+		group.InviteCode = &code
+		if err := s.Groups.Save(&group); err != nil {
+			http.Error(w, "Could not save invite code", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"invite_code": *group.InviteCode})
+}
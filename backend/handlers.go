@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -9,9 +10,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
-func handleRegister(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -26,8 +28,13 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var existingUser User
-	if err := DB.Where("usn = ?", input.USN).First(&existingUser).Error; err == nil {
+	parsed, err := parseUSN(input.USN)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.Users.GetByUSN(parsed.USN); err == nil {
 		http.Error(w, "USN already registered. Please login.", http.StatusConflict)
 		return
 	}
@@ -36,16 +43,16 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	if role == "" {
 		role = "user"
 	}
-	user := User{USN: input.USN, Role: role}
-	if err := DB.Create(&user).Error; err != nil {
+	user := User{USN: parsed.USN, AdmissionYear: parsed.Year, Branch: parsed.Branch, Role: role}
+	if err := s.Users.Create(&user); err != nil {
 		http.Error(w, "Could not register user", http.StatusInternalServerError)
 		return
 	}
 
-	generateTokenResponse(w, user)
+	s.generateTokenResponse(w, user)
 }
 
-func handleLogin(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -59,17 +66,16 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	result := DB.Where("usn = ?", input.USN).First(&user)
-	if result.Error != nil {
+	user, err := findUserByUSN(s.Users, input.USN)
+	if err != nil {
 		http.Error(w, "USN not found. Please register first.", http.StatusNotFound)
 		return
 	}
 
-	generateTokenResponse(w, user)
+	s.generateTokenResponse(w, user)
 }
 
-func generateTokenResponse(w http.ResponseWriter, user User) {
+func (s *Server) generateTokenResponse(w http.ResponseWriter, user User) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"id":   user.ID,
 		"usn":  user.USN,
@@ -77,7 +83,7 @@ func generateTokenResponse(w http.ResponseWriter, user User) {
 		"exp":  time.Now().Add(time.Hour * 24).Unix(),
 	})
 
-	tokenString, err := token.SignedString(JWTSecret)
+	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
 	if err != nil {
 		http.Error(w, "Could not generate token", http.StatusInternalServerError)
 		return
@@ -89,33 +95,41 @@ func generateTokenResponse(w http.ResponseWriter, user User) {
 	})
 }
 
-func getRoleFromToken(r *http.Request) string {
-	tokenString := r.Header.Get("Authorization")
-	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return JWTSecret, nil
-	})
-	if token == nil {
-		return ""
-	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return ""
-	}
-	return claims["role"].(string)
+// tokenClaims returns the claims of the request's token, or nil unless it
+// carries a valid signature.
+func (s *Server) tokenClaims(r *http.Request) jwt.MapClaims {
+	return s.parseToken(r.Header.Get("Authorization"))
 }
 
-func handleRooms(w http.ResponseWriter, r *http.Request) {
+// parseToken returns the claims of tokenString, or nil unless it carries a
+// valid signature. jwt.Parse fills in claims even when it fails.
+func (s *Server) parseToken(tokenString string) jwt.MapClaims {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+func (s *Server) getRoleFromToken(r *http.Request) string {
+	role, _ := s.tokenClaims(r)["role"].(string)
+	return role
+}
+
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		log.Println("GET /api/rooms called")
-		var rooms []Room
-		DB.Where("is_closed = ? AND expires_at > ?", false, time.Now()).Order("created_at desc").Find(&rooms)
+		rooms, _ := s.Rooms.ListOpen(time.Now())
 		log.Printf("Found %d rooms", len(rooms))
 		json.NewEncoder(w).Encode(rooms)
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		if getRoleFromToken(r) != "admin" {
+		if s.getRoleFromToken(r) != "admin" {
 			http.Error(w, "Forbidden: Only admins can create rooms", http.StatusForbidden)
 			return
 		}
@@ -149,13 +163,13 @@ func handleRooms(w http.ResponseWriter, r *http.Request) {
 			ExpiresAt:    time.Now().Add(time.Duration(input.TimerMinutes) * time.Minute),
 			GroupID:      groupIDPtr,
 		}
-		DB.Create(&room)
+		s.Rooms.Create(&room)
 		json.NewEncoder(w).Encode(room)
 		return
 	}
 }
 
-func handleCloseRoom(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleCloseRoom(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -169,44 +183,107 @@ func handleCloseRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	DB.Model(&Room{}).Where("id = ?", input.RoomID).Update("is_closed", true)
+	s.Rooms.Close(input.RoomID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func handleEvents(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var events []Event
-		DB.Order("event_date asc").Find(&events)
+		events, _ := s.Events.List(s.viewerFromRequest(r), time.Time{})
 		json.NewEncoder(w).Encode(events)
 		return
 	}
 
 	// Admin can post events
 	if r.Method == http.MethodPost {
-		if getRoleFromToken(r) != "admin" {
+		if s.getRoleFromToken(r) != "admin" {
 			http.Error(w, "Forbidden: Only admins can post events", http.StatusForbidden)
 			return
 		}
 
-		var event Event
-		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		var input struct {
+			Event
+			Recurrence *RecurrenceRule `json:"recurrence"`
+			RRule      string          `json:"rrule"`
+			GroupIDs   []uuid.UUID     `json:"group_ids"` // Restrict to members of these groups
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid input", http.StatusBadRequest)
 			return
 		}
-		DB.Create(&event)
+		rule, err := recurrenceFromInput(input.Recurrence, input.RRule)
+		if err != nil {
+			http.Error(w, "Invalid recurrence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateGroupIDs(s.Groups, input.GroupIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		event := input.Event
+		event.Groups = nil // Set through group_ids
+		if rule != nil {
+			var series Series
+			var events []Event
+			err := s.Transaction(func(tx Stores) error {
+				var err error
+				series, events, err = createEventSeries(tx, event, *rule)
+				if err != nil {
+					return err
+				}
+				ids := make([]uuid.UUID, len(events))
+				for i, e := range events {
+					ids[i] = e.ID
+				}
+				return tx.Events.SetGroups(ids, input.GroupIDs)
+			})
+			if err != nil {
+				if errors.Is(err, errInvalidRecurrence) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "Could not create event series", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"series": series,
+				"events": events,
+			})
+			return
+		}
+		err = s.Transaction(func(tx Stores) error {
+			if err := tx.Events.Create(&event); err != nil {
+				return err
+			}
+			return tx.Events.SetGroups([]uuid.UUID{event.ID}, input.GroupIDs)
+		})
+		if err != nil {
+			http.Error(w, "Could not create event", http.StatusInternalServerError)
+			return
+		}
 		json.NewEncoder(w).Encode(event)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if s.getRoleFromToken(r) != "admin" {
+			http.Error(w, "Forbidden: Only admins can edit events", http.StatusForbidden)
+			return
+		}
+		s.handleEventUpdate(w, r)
 	}
 }
 
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	roomID := r.URL.Query().Get("room")
 	userUSN := r.URL.Query().Get("usn")
 	userIDStr := r.URL.Query().Get("userId")
 	userID, _ := uuid.Parse(userIDStr)
 
 	// Validate room existence and expiration
-	var room Room
-	if err := DB.First(&room, "id = ?", roomID).Error; err != nil {
+	room, err := s.Rooms.Get(roomID)
+	if err != nil {
 		http.Error(w, "Room not found", http.StatusNotFound)
 		return
 	}
@@ -221,12 +298,12 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Check group restriction
 	if room.GroupID != nil {
-		var user User
-		if err := DB.First(&user, "id = ?", userID).Error; err != nil {
+		user, err := s.Users.Get(userID)
+		if err != nil {
 			http.Error(w, "User not found", http.StatusUnauthorized)
 			return
 		}
-		if user.GroupID == nil || *user.GroupID != *room.GroupID {
+		if !isGroupMember(s.Groups, user.ID, *room.GroupID) {
 			// Optional: Allow admin formatted override if needed, but strict for now
 			http.Error(w, "Access Denied: Room restricted to group members", http.StatusForbidden)
 			return
@@ -242,23 +319,25 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	client := &Client{
 		ID:   userID.String(),
 		Conn: conn,
-		Send: make(chan []byte, 256),
+		Send: make(chan []byte, s.config.ClientSendBuffer),
 		Room: roomID,
 	}
 
 	// Fetch recent history
-	var history []Message
-	DB.Where("room_id = ?", roomID).Order("created_at asc").Limit(100).Find(&history)
+	history, _ := s.Messages.History(roomID, 100)
 	for _, msg := range history {
 		msgBytes, _ := json.Marshal(msg)
 		client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
 	}
 
-	hub.Register <- client
+	if !s.hub.register(client) {
+		conn.Close()
+		return
+	}
 
 	go func() {
 		defer func() {
-			hub.Unregister <- client
+			s.hub.unregister(client)
 			conn.Close()
 		}()
 		for {
@@ -274,9 +353,9 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				UserUSN: userUSN,
 				Content: string(message),
 			}
-			DB.Create(&msg)
+			s.Messages.Create(&msg)
 
-			hub.Broadcast <- msg
+			s.hub.broadcast(msg)
 		}
 	}()
 
@@ -287,22 +366,8 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
-func getUserIDFromToken(r *http.Request) uuid.UUID {
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		return uuid.Nil
-	}
-	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return JWTSecret, nil
-	})
-	if token == nil {
-		return uuid.Nil
-	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return uuid.Nil
-	}
-	idStr, ok := claims["id"].(string)
+func (s *Server) getUserIDFromToken(r *http.Request) uuid.UUID {
+	idStr, ok := s.tokenClaims(r)["id"].(string)
 	if !ok {
 		return uuid.Nil
 	}
@@ -310,16 +375,16 @@ func getUserIDFromToken(r *http.Request) uuid.UUID {
 	return id
 }
 
-func handleProfile(w http.ResponseWriter, r *http.Request) {
-	userID := getUserIDFromToken(r)
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserIDFromToken(r)
 	if userID == uuid.Nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	if r.Method == http.MethodGet {
-		var user User
-		if err := DB.Preload("Group").Preload("ActivityRegistrations.Activity").First(&user, "id = ?", userID).Error; err != nil {
+		user, err := s.Users.GetProfile(userID)
+		if err != nil {
 			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
@@ -327,39 +392,24 @@ func handleProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Method == http.MethodPut {
-		var input struct {
-			Name         string    `json:"name"`
-			Bio          string    `json:"bio"`
-			ProfileImage string    `json:"profile_image"`
-			GroupID      uuid.UUID `json:"group_id"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-			http.Error(w, "Invalid input", http.StatusBadRequest)
-			return
-		}
-
-		DB.Model(&User{}).Where("id = ?", userID).Updates(User{
-			Name:         input.Name,
-			Bio:          input.Bio,
-			ProfileImage: input.ProfileImage,
-			GroupID:      &input.GroupID,
-		})
-		w.WriteHeader(http.StatusNoContent)
+	// PUT is kept for older clients; both only touch the fields sent.
+	if r.Method == http.MethodPatch || r.Method == http.MethodPut {
+		s.handleProfileUpdate(w, r, userID)
 		return
 	}
+
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-func handleGroups(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var groups []Group
-		DB.Find(&groups)
+		groups, _ := s.Groups.List()
 		json.NewEncoder(w).Encode(groups)
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		if getRoleFromToken(r) != "admin" {
+		if s.getRoleFromToken(r) != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
@@ -368,19 +418,36 @@ func handleGroups(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid input", http.StatusBadRequest)
 			return
 		}
-		DB.Create(&group)
+		if !validJoinPolicy(group.JoinPolicy) {
+			http.Error(w, "join_policy must be 'open', 'approval' or 'invite'", http.StatusBadRequest)
+			return
+		}
+		if group.OwnerID == nil {
+			ownerID := s.getUserIDFromToken(r)
+			group.OwnerID = &ownerID
+		}
+		err := s.Transaction(func(tx Stores) error {
+			if err := tx.Groups.Create(&group); err != nil {
+				return err
+			}
+			return tx.Groups.AddMember(*group.OwnerID, group.ID, "owner")
+		})
+		if err != nil {
+			http.Error(w, "Could not create group", http.StatusInternalServerError)
+			return
+		}
 		json.NewEncoder(w).Encode(group)
 		return
 	}
 }
 
-func handleEventRegister(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleEventRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := getUserIDFromToken(r)
+	userID := s.getUserIDFromToken(r)
 	if userID == uuid.Nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -388,15 +455,46 @@ func handleEventRegister(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
 		EventID uuid.UUID `json:"event_id"`
+		Series  bool      `json:"series"` // Also register for every later occurrence
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
+	event, err := s.Events.Get(input.EventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if !s.Events.CanAccess(s.viewerFromRequest(r), event.ID) {
+		http.Error(w, "Access Denied: Event restricted to group members", http.StatusForbidden)
+		return
+	}
+
+	if input.Series {
+		regs, err := registerEventSeries(s.Stores, s.viewerFromRequest(r), userID, event)
+		if err != nil {
+			if errors.Is(err, errNotInSeries) {
+				http.Error(w, "Event is not part of a series", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, gorm.ErrForeignKeyViolated) {
+				http.Error(w, "Event no longer exists", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Registration failed", http.StatusInternalServerError)
+			return
+		}
+		for _, reg := range regs {
+			s.publishRegistration(reg, "registered")
+		}
+		json.NewEncoder(w).Encode(regs)
+		return
+	}
+
 	// Check if already registered
-	var existing Registration
-	if err := DB.Where("event_id = ? AND user_id = ?", input.EventID, userID).First(&existing).Error; err == nil {
+	if _, err := s.Registrations.Find(input.EventID, userID); err == nil {
 		http.Error(w, "Already registered", http.StatusConflict)
 		return
 	}
@@ -407,119 +505,200 @@ func handleEventRegister(w http.ResponseWriter, r *http.Request) {
 		QRCodeToken: uuid.New().String(),
 		Status:      "registered",
 	}
-	if err := DB.Create(&reg).Error; err != nil {
+	if err := s.Registrations.Create(&reg); err != nil {
+		// The check above can race with a concurrent request.
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			http.Error(w, "Already registered", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			http.Error(w, "Event no longer exists", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Registration failed", http.StatusInternalServerError)
 		return
 	}
+	s.publishRegistration(reg, "registered")
 
 	json.NewEncoder(w).Encode(reg)
 }
 
-func handleEventRegistrations(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleEventRegistrations(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	role := getRoleFromToken(r)
-	userID := getUserIDFromToken(r)
+	role := s.getRoleFromToken(r)
+	userID := s.getUserIDFromToken(r)
 
-	eventID := r.URL.Query().Get("event_id")
-	if eventID != "" {
+	if eventIDStr := r.URL.Query().Get("event_id"); eventIDStr != "" {
 		// Admin/Organizer view
 		if role != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		var regs []Registration
-		DB.Where("event_id = ?", eventID).Find(&regs)
+		eventID, err := uuid.Parse(eventIDStr)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+		regs, _ := s.Registrations.ListForEvent(eventID)
 		json.NewEncoder(w).Encode(regs)
 		return
 	}
 
 	// User view
-	var regs []Registration
-	DB.Where("user_id = ?", userID).Find(&regs)
+	regs, _ := s.Registrations.ListForUser(userID)
 	json.NewEncoder(w).Encode(regs)
 }
 
-func handleEventCheckIn(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleEventCheckIn(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if getRoleFromToken(r) != "admin" {
+	if s.getRoleFromToken(r) != "admin" {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
 	var input struct {
 		QRCodeToken string `json:"qr_code_token"`
+		Toggle      bool   `json:"toggle"` // Scanning a checked-in ticket again checks it out
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	var reg Registration
-	if err := DB.Preload("User").Preload("Event").Where("qr_code_token = ?", input.QRCodeToken).First(&reg).Error; err != nil {
-		http.Error(w, "Invalid token", http.StatusNotFound)
-		return
-	}
-
-	if reg.Status == "checked_in" {
-		http.Error(w, "Already checked in", http.StatusConflict)
+	reg, err := s.scanEventToken(input.QRCodeToken, input.Toggle)
+	if err != nil {
+		writeScanError(w, err)
 		return
 	}
 
-	now := time.Now()
-	DB.Model(&reg).Updates(Registration{
-		Status:      "checked_in",
-		CheckedInAt: &now,
-	})
-
 	json.NewEncoder(w).Encode(reg)
 }
 
-func handleActivities(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var activities []Activity
-		DB.Order("start_time asc").Find(&activities)
+		var eventID *uuid.UUID
+		if eventIDStr := r.URL.Query().Get("event_id"); eventIDStr != "" {
+			id, err := uuid.Parse(eventIDStr)
+			if err != nil {
+				http.Error(w, "Invalid event ID", http.StatusBadRequest)
+				return
+			}
+			eventID = &id
+		}
+		activities, _ := s.Activities.List(s.viewerFromRequest(r), eventID)
 		json.NewEncoder(w).Encode(activities)
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		if getRoleFromToken(r) != "admin" {
+		if s.getRoleFromToken(r) != "admin" {
 			http.Error(w, "Forbidden: Only admins can post activities", http.StatusForbidden)
 			return
 		}
 
-		var activity Activity
-		if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
+		var input struct {
+			Activity
+			Recurrence *RecurrenceRule `json:"recurrence"`
+			RRule      string          `json:"rrule"`
+			GroupIDs   []uuid.UUID     `json:"group_ids"` // Restrict to members of these groups
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid input", http.StatusBadRequest)
 			return
 		}
-		DB.Create(&activity)
+		rule, err := recurrenceFromInput(input.Recurrence, input.RRule)
+		if err != nil {
+			http.Error(w, "Invalid recurrence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateGroupIDs(s.Groups, input.GroupIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		activity := input.Activity
+		activity.Groups = nil // Set through group_ids
+		normalizeActivityEventID(&activity)
+		if err := validateActivitySchedule(s.Events, s.config.Location, activity); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rule != nil {
+			var series Series
+			var activities []Activity
+			err := s.Transaction(func(tx Stores) error {
+				var err error
+				series, activities, err = createActivitySeries(tx, s.config.Location, activity, *rule)
+				if err != nil {
+					return err
+				}
+				ids := make([]uuid.UUID, len(activities))
+				for i, a := range activities {
+					ids[i] = a.ID
+				}
+				return tx.Activities.SetGroups(ids, input.GroupIDs)
+			})
+			if err != nil {
+				if errors.Is(err, errActivityOutsideEvent) || errors.Is(err, errInvalidRecurrence) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "Could not create activity series", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"series":     series,
+				"activities": activities,
+			})
+			return
+		}
+		err = s.Transaction(func(tx Stores) error {
+			if err := tx.Activities.Create(&activity); err != nil {
+				return err
+			}
+			return tx.Activities.SetGroups([]uuid.UUID{activity.ID}, input.GroupIDs)
+		})
+		if err != nil {
+			http.Error(w, "Could not create activity", http.StatusInternalServerError)
+			return
+		}
 		json.NewEncoder(w).Encode(activity)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if s.getRoleFromToken(r) != "admin" {
+			http.Error(w, "Forbidden: Only admins can edit activities", http.StatusForbidden)
+			return
+		}
+		s.handleActivityUpdate(w, r)
 	}
 }
 
-func handleActivityRegister(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleActivityRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := getUserIDFromToken(r)
+	userID := s.getUserIDFromToken(r)
 	if userID == uuid.Nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	var input struct {
-		ActivityID uuid.UUID `json:"activity_id"`
+		ActivityID     uuid.UUID `json:"activity_id"`
+		Series         bool      `json:"series"`          // Also register for every later occurrence
+		AllowConflicts bool      `json:"allow_conflicts"` // Register despite overlapping activities
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
@@ -527,29 +706,52 @@ func handleActivityRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Double check user exists to get USN
-	var user User
-	if err := DB.First(&user, "id = ?", userID).Error; err != nil {
+	user, err := s.Users.Get(userID)
+	if err != nil {
 		http.Error(w, "User not found", http.StatusBadRequest)
 		return
 	}
 
-	// Check if already registered
-	var existing ActivityRegistration
-	if err := DB.Where("activity_id = ? AND user_id = ?", input.ActivityID, userID).First(&existing).Error; err == nil {
-		http.Error(w, "Already registered for this activity", http.StatusConflict)
+	activity, err := s.Activities.Get(input.ActivityID)
+	if err != nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	if !s.Activities.CanAccess(s.viewerFromRequest(r), activity.ID) {
+		http.Error(w, "Access Denied: Activity restricted to group members", http.StatusForbidden)
 		return
 	}
 
-	reg := ActivityRegistration{
-		ActivityID: input.ActivityID,
-		UserID:     userID,
-		UserUSN:    user.USN,
-		Status:     "registered",
+	if input.Series {
+		regs, err := registerActivitySeries(s.Stores, s.viewerFromRequest(r), user, activity, input.AllowConflicts)
+		if err != nil {
+			if errors.Is(err, errNotInSeries) {
+				http.Error(w, "Activity is not part of a series", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, gorm.ErrForeignKeyViolated) {
+				http.Error(w, "Activity no longer exists", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Registration failed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(regs)
+		return
 	}
-	if err := DB.Create(&reg).Error; err != nil {
-		http.Error(w, "Registration failed", http.StatusInternalServerError)
+
+	reg, overlaps, err := registerForActivity(s.Stores, user, input.ActivityID, input.AllowConflicts)
+	if err != nil {
+		writeActivityRegisterError(w, err, overlaps)
 		return
 	}
 
+	if len(overlaps) > 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"registration": reg,
+			"conflicts":    overlaps,
+		})
+		return
+	}
 	json.NewEncoder(w).Encode(reg)
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	icalTimeLayout = "20060102T150405Z"
+	icalProdID     = "-//JSS Rooms//Events//EN"
+	icalUIDDomain  = "jssrooms"
+
+	// Events only carry a start time; calendars get this much blocked out.
+	defaultEventDuration = 2 * time.Hour
+)
+
+// icalEntry is one VEVENT. Times are written in UTC so clients convert them
+// to the viewer's zone.
+type icalEntry struct {
+	UID         string
+	Start, End  time.Time
+	Summary     string
+	Description string
+	Location    string
+	Categories  string
+	Created     time.Time
+}
+
+func eventICalEntry(e Event) icalEntry {
+	return icalEntry{
+		UID:         fmt.Sprintf("event-%s@%s", e.ID, icalUIDDomain),
+		Start:       e.EventDate,
+		End:         e.EventDate.Add(defaultEventDuration),
+		Summary:     e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		Categories:  e.Category,
+		Created:     e.CreatedAt,
+	}
+}
+
+func activityICalEntry(a Activity) icalEntry {
+	end := a.EndTime
+	if !end.After(a.StartTime) {
+		end = a.StartTime
+	}
+	return icalEntry{
+		UID:         fmt.Sprintf("activity-%s@%s", a.ID, icalUIDDomain),
+		Start:       a.StartTime,
+		End:         end,
+		Summary:     a.Title,
+		Description: a.Description,
+		Location:    a.Location,
+		Created:     a.CreatedAt,
+	}
+}
+
+// icalEscape escapes a TEXT value per RFC 5545 section 3.3.11.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// icalLine folds a content line at 75 octets without splitting UTF-8 sequences.
+func icalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if cut == 0 {
+			cut = limit // Not UTF-8 after all; any cut will do
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func renderICal(name string, entries []icalEntry) string {
+	var b strings.Builder
+	stamp := time.Now().UTC().Format(icalTimeLayout)
+
+	icalLine(&b, "BEGIN:VCALENDAR")
+	icalLine(&b, "VERSION:2.0")
+	icalLine(&b, "PRODID:"+icalProdID)
+	icalLine(&b, "CALSCALE:GREGORIAN")
+	icalLine(&b, "METHOD:PUBLISH")
+	icalLine(&b, "X-WR-CALNAME:"+icalEscape(name))
+	for _, e := range entries {
+		icalLine(&b, "BEGIN:VEVENT")
+		icalLine(&b, "UID:"+e.UID)
+		icalLine(&b, "DTSTAMP:"+stamp)
+		icalLine(&b, "DTSTART:"+e.Start.UTC().Format(icalTimeLayout))
+		icalLine(&b, "DTEND:"+e.End.UTC().Format(icalTimeLayout))
+		if !e.Created.IsZero() {
+			icalLine(&b, "CREATED:"+e.Created.UTC().Format(icalTimeLayout))
+		}
+		icalLine(&b, "SUMMARY:"+icalEscape(e.Summary))
+		if e.Description != "" {
+			icalLine(&b, "DESCRIPTION:"+icalEscape(e.Description))
+		}
+		if e.Location != "" {
+			icalLine(&b, "LOCATION:"+icalEscape(e.Location))
+		}
+		if e.Categories != "" {
+			icalLine(&b, "CATEGORIES:"+icalEscape(e.Categories))
+		}
+		icalLine(&b, "END:VEVENT")
+	}
+	icalLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// writeICal sends a calendar; disposition is "inline" for subscribable feeds
+// and "attachment" for one-off downloads.
+func writeICal(w http.ResponseWriter, disposition, filename, name string, entries []icalEntry) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+	w.Write([]byte(renderICal(name, entries)))
+}
+
+// handleEventsICal serves the public feed of upcoming events.
+func (s *Server) handleEventsICal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events, _ := s.Events.List(s.viewerFromRequest(r), time.Now())
+
+	entries := make([]icalEntry, 0, len(events))
+	for _, e := range events {
+		entries = append(entries, eventICalEntry(e))
+	}
+	writeICal(w, "inline", "events.ics", "JSS Events", entries)
+}
+
+// handleEventICal serves a single event as a downloadable .ics file.
+func (s *Server) handleEventICal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := uuid.Parse(r.URL.Query().Get("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	event, err := s.Events.Get(eventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if !s.Events.CanAccess(s.viewerFromRequest(r), event.ID) {
+		http.Error(w, "Access Denied: Event restricted to group members", http.StatusForbidden)
+		return
+	}
+
+	writeICal(w, "attachment", exportSlug(event.Title)+".ics", event.Title, []icalEntry{eventICalEntry(event)})
+}
+
+// handleUserICal serves a user's events and activities. Calendar apps can't
+// send an Authorization header, so the feed is keyed by a secret token.
+func (s *Server) handleUserICal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := s.Users.GetByCalendarToken(token)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	regs, _ := s.Registrations.ListActiveForUser(user.ID)
+	activityRegs, _ := s.Registrations.ListActiveActivitiesForUser(user.ID)
+
+	entries := make([]icalEntry, 0, len(regs)+len(activityRegs))
+	for _, reg := range regs {
+		if reg.Event != nil {
+			entries = append(entries, eventICalEntry(*reg.Event))
+		}
+	}
+	for _, reg := range activityRegs {
+		if reg.Activity != nil {
+			entries = append(entries, activityICalEntry(*reg.Activity))
+		}
+	}
+	writeICal(w, "inline", "my-schedule.ics", "My JSS Schedule", entries)
+}
+
+func newCalendarToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// handleCalendarToken returns the caller's feed token, creating it on first
+// use. POST rotates it, invalidating previously shared feed URLs.
+func (s *Server) handleCalendarToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := s.getUserIDFromToken(r)
+	if userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := s.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if user.CalendarToken == nil || r.Method == http.MethodPost {
+		token, err := newCalendarToken()
+		if err != nil {
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		if err := s.Users.Update(user.ID, UserChanges{CalendarToken: &token}); err != nil {
+			http.Error(w, "Could not save token", http.StatusInternalServerError)
+			return
+		}
+		user.CalendarToken = &token
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"token": *user.CalendarToken,
+		"path":  "/api/calendar/me.ics?token=" + *user.CalendarToken,
+	})
+}
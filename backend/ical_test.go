@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICalEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		"Hall A":            "Hall A",
+		`C:\temp`:           `C:\\temp`,
+		"Talks; demos, Q&A": `Talks\; demos\, Q&A`,
+		"one\ntwo":          `one\ntwo`,
+		"one\r\ntwo":        `one\ntwo`,
+		"one\rtwo":          `one\ntwo`,
+	} {
+		if got := icalEscape(in); got != want {
+			t.Errorf("icalEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestICalLineFolding(t *testing.T) {
+	for name, line := range map[string]string{
+		"ascii":        "DESCRIPTION:" + strings.Repeat("a", 300),
+		"multibyte":    "SUMMARY:" + strings.Repeat("ಕನ್ನಡ ", 40),
+		"emoji":        "SUMMARY:" + strings.Repeat("🎉", 60),
+		"invalid utf8": "DESCRIPTION:" + strings.Repeat("\x80", 300),
+		"short":        "BEGIN:VEVENT",
+	} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan string)
+			go func() {
+				var b strings.Builder
+				icalLine(&b, line)
+				done <- b.String()
+			}()
+			var out string
+			select {
+			case out = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("icalLine did not return")
+			}
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("%q does not end the line", out)
+			}
+			folded := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			unfolded := folded[0]
+			for i, l := range folded {
+				if len(l) > 75 {
+					t.Errorf("line %d is %d octets", i, len(l))
+				}
+				if i > 0 {
+					if !strings.HasPrefix(l, " ") {
+						t.Fatalf("continuation %q does not start with a space", l)
+					}
+					unfolded += l[1:]
+				}
+				if utf8.ValidString(line) && !utf8.ValidString(l) {
+					t.Errorf("line %d splits a UTF-8 sequence", i)
+				}
+			}
+			if unfolded != line {
+				t.Errorf("unfolds to %q", unfolded)
+			}
+		})
+	}
+}
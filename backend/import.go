@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upper bound on an uploaded import file.
+const maxImportSize = 10 << 20
+
+var errDryRun = errors.New("dry run")
+
+type importRowResult struct {
+	Row        int      `json:"row"` // 1-based, excluding the CSV header
+	ExternalID string   `json:"external_id,omitempty"`
+	Action     string   `json:"action"` // 'created', 'updated' or 'skipped'
+	Errors     []string `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	Kind    string            `json:"kind"`
+	DryRun  bool              `json:"dry_run"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Rows    []importRowResult `json:"rows"`
+}
+
+// parseImportRows reads a JSON array of objects or a CSV file with a header
+// row into field maps, so both formats share one validation path.
+func parseImportRows(data []byte, format string) ([]map[string]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Dumps exported on Windows carry a BOM
+
+	switch format {
+	case "json":
+		var raw []map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		rows := make([]map[string]string, 0, len(raw))
+		for _, obj := range raw {
+			row := make(map[string]string, len(obj))
+			for k, v := range obj {
+				switch v := v.(type) {
+				case nil:
+				case string:
+					row[k] = v
+				case float64:
+					row[k] = strconv.FormatFloat(v, 'f', -1, 64)
+				default:
+					row[k] = fmt.Sprint(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case "csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		header := records[0]
+		rows := make([]map[string]string, 0, len(records)-1)
+		for _, rec := range records[1:] {
+			row := make(map[string]string, len(header))
+			for i, col := range header {
+				if i < len(rec) {
+					row[strings.TrimSpace(col)] = rec[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// importExternalID keys a row for idempotent re-imports. Dumps of our own
+// tables have no external_id, so their original id is used instead.
+func importExternalID(row map[string]string) string {
+	if id := strings.TrimSpace(row["external_id"]); id != "" {
+		return id
+	}
+	return strings.TrimSpace(row["id"])
+}
+
+func parseImportTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	// datetime-local values as sent by the admin dashboard
+	return time.ParseInLocation("2006-01-02T15:04", s, loc)
+}
+
+// importTimeError explains a value parseImportTime rejected.
+func importTimeError(field string, loc *time.Location) string {
+	return fmt.Sprintf("%s must be an RFC 3339 timestamp such as 2026-11-02T09:30:00+05:30, "+
+		"or a local date and time such as 2026-11-02T09:30, which is read in %s", field, loc)
+}
+
+// parseImportUUID treats empty and all-zero IDs as absent.
+func parseImportUUID(s string) (uuid.UUID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(s)
+}
+
+func eventFromImportRow(loc *time.Location, row map[string]string) (Event, []string) {
+	var errs []string
+	event := Event{
+		Title:       strings.TrimSpace(row["title"]),
+		Description: row["description"],
+		Category:    row["category"],
+		ImageUrl:    row["image_url"],
+		Location:    row["location"],
+	}
+	if event.Title == "" {
+		errs = append(errs, "title is required")
+	}
+	if s := strings.TrimSpace(row["capacity"]); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			errs = append(errs, "capacity must be a non-negative integer")
+		}
+		event.Capacity = n
+	}
+	if t, err := parseImportTime(row["event_date"], loc); err != nil {
+		errs = append(errs, importTimeError("event_date", loc))
+	} else {
+		event.EventDate = t
+	}
+	if id, err := parseImportUUID(row["organizer_id"]); err != nil {
+		errs = append(errs, "organizer_id must be a UUID")
+	} else {
+		event.OrganizerID = id
+	}
+	return event, errs
+}
+
+func activityFromImportRow(events EventStore, loc *time.Location, row map[string]string) (Activity, []string) {
+	var errs []string
+	activity := Activity{
+		Title:       strings.TrimSpace(row["title"]),
+		Description: row["description"],
+		ImageUrl:    row["image_url"],
+		Location:    row["location"],
+	}
+	if activity.Title == "" {
+		errs = append(errs, "title is required")
+	}
+	if s := strings.TrimSpace(row["capacity"]); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			errs = append(errs, "capacity must be a non-negative integer")
+		}
+		activity.Capacity = n
+	}
+	start, err := parseImportTime(row["start_time"], loc)
+	if err != nil {
+		errs = append(errs, importTimeError("start_time", loc))
+	}
+	end, err := parseImportTime(row["end_time"], loc)
+	if err != nil {
+		errs = append(errs, importTimeError("end_time", loc))
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		errs = append(errs, "end_time is before start_time")
+	}
+	activity.StartTime, activity.EndTime = start, end
+
+	// The parent event may be given by our ID or by the external ID it was imported with.
+	if ext := strings.TrimSpace(row["event_external_id"]); ext != "" {
+		event, err := events.GetByExternalID(ext)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("no event with external_id %q", ext))
+		} else {
+			activity.EventID = &event.ID
+		}
+	} else if id, err := parseImportUUID(row["event_id"]); err != nil {
+		errs = append(errs, "event_id must be a UUID")
+	} else if id != uuid.Nil {
+		// A dump of our own tables keys events by their original id, which
+		// becomes the external ID of the event imported from it.
+		event, err := events.Get(id)
+		if err != nil {
+			event, err = events.GetByExternalID(id.String())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("no event with id %s", id))
+		} else {
+			activity.EventID = &event.ID
+		}
+	}
+	if len(errs) == 0 {
+		if err := validateActivitySchedule(events, loc, activity); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return activity, errs
+}
+
+// importRecords validates and upserts rows of the given kind ("events" or
+// "activities") keyed on their external ID. Invalid rows are reported and
+// skipped. With dryRun the whole import runs and is then rolled back, so the
+// report reflects exactly what a real run would do.
+func importRecords(stores Stores, loc *time.Location, kind string, rows []map[string]string, dryRun bool) (importReport, error) {
+	report := importReport{Kind: kind, DryRun: dryRun, Rows: make([]importRowResult, 0, len(rows))}
+	if kind != "events" && kind != "activities" {
+		return report, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	err := stores.Transaction(func(tx Stores) error {
+		seen := make(map[string]int)
+		for i, row := range rows {
+			res := importRowResult{Row: i + 1, ExternalID: importExternalID(row)}
+
+			var errs []string
+			if res.ExternalID == "" {
+				errs = append(errs, "external_id (or id) is required")
+			} else if prev, ok := seen[res.ExternalID]; ok {
+				errs = append(errs, fmt.Sprintf("duplicate of row %d", prev))
+			}
+
+			var err error
+			switch kind {
+			case "events":
+				event, rowErrs := eventFromImportRow(loc, row)
+				errs = append(errs, rowErrs...)
+				if len(errs) == 0 {
+					res.Action, err = upsertImportedEvent(tx.Events, res.ExternalID, event)
+				}
+			case "activities":
+				activity, rowErrs := activityFromImportRow(tx.Events, loc, row)
+				errs = append(errs, rowErrs...)
+				if len(errs) == 0 {
+					res.Action, err = upsertImportedActivity(tx.Activities, res.ExternalID, activity)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(errs) > 0 {
+				res.Action = "skipped"
+				res.Errors = errs
+				report.Skipped++
+			} else {
+				seen[res.ExternalID] = res.Row
+				if res.Action == "created" {
+					report.Created++
+				} else {
+					report.Updated++
+				}
+			}
+			report.Rows = append(report.Rows, res)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return report, err
+	}
+	return report, nil
+}
+
+func upsertImportedEvent(events EventStore, externalID string, event Event) (string, error) {
+	event.ExternalID = &externalID
+	return importAction(events.Upsert(&event))
+}
+
+func upsertImportedActivity(activities ActivityStore, externalID string, activity Activity) (string, error) {
+	activity.ExternalID = &externalID
+	return importAction(activities.Upsert(&activity))
+}
+
+func importAction(created bool, err error) (string, error) {
+	if created {
+		return "created", err
+	}
+	return "updated", err
+}
+
+// handleImport accepts an events or activities file as the request body:
+// POST /api/import?kind=events&format=csv&dry_run=true. The format defaults
+// to the request Content-Type.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = "csv"
+		}
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Import file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	rows, err := parseImportRows(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if kind != "events" && kind != "activities" {
+		http.Error(w, "kind must be 'events' or 'activities'", http.StatusBadRequest)
+		return
+	}
+	report, err := importRecords(s.Stores, s.config.Location, kind, rows, dryRun)
+	if err != nil {
+		http.Error(w, "Import failed", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// runImportCommand implements `backend import`, e.g.
+//
+//	backend import -kind events -dry-run ../events.json
+func runImportCommand(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := fs.String("kind", "", "record kind: events or activities")
+	format := fs.String("format", "", "json or csv (default: from file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate and report without writing")
+	config := configFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || (*kind != "events" && *kind != "activities") {
+		fmt.Fprintln(os.Stderr, "usage: backend import -kind events|activities [-format json|csv] [-dry-run] [config flags] FILE")
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := parseImportRows(data, *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.load()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	report, err := importRecords(newGormStores(initDB(cfg)), cfg.Location, *kind, rows, *dryRun)
+	if err != nil {
+		log.Fatal("Import failed: ", err)
+	}
+
+	for _, row := range report.Rows {
+		if len(row.Errors) > 0 {
+			fmt.Printf("row %d (%s): %s\n", row.Row, row.ExternalID, strings.Join(row.Errors, "; "))
+		}
+	}
+	prefix := ""
+	if report.DryRun {
+		prefix = "[dry run] "
+	}
+	fmt.Printf("%s%s: %d created, %d updated, %d skipped\n", prefix, report.Kind, report.Created, report.Updated, report.Skipped)
+	if report.Skipped > 0 {
+		os.Exit(1)
+	}
+}
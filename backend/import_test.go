@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestImportDumpRoundTrip imports dumps of our own events and activities
+// tables, where rows are keyed by id and activities point at the original
+// event id.
+func TestImportDumpRoundTrip(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			stores := backend.stores(t)
+			originalEventID := uuid.New().String()
+
+			events := []map[string]string{{
+				"id":         originalEventID,
+				"title":      "Tech fest",
+				"event_date": "2026-11-02T09:00:00Z",
+			}}
+			report, err := importRecords(stores, time.UTC, "events", events, false)
+			if err != nil || report.Created != 1 {
+				t.Fatalf("events import: %+v, %v", report, err)
+			}
+			event, err := stores.Events.GetByExternalID(originalEventID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			activities := []map[string]string{{
+				"id":         uuid.New().String(),
+				"title":      "Keynote",
+				"event_id":   originalEventID,
+				"start_time": "2026-11-02T10:00:00Z",
+				"end_time":   "2026-11-02T11:00:00Z",
+			}}
+			for _, want := range []int{1, 0} { // Created, then updated on re-import
+				report, err = importRecords(stores, time.UTC, "activities", activities, false)
+				if err != nil || report.Skipped != 0 || report.Created != want {
+					t.Fatalf("activities import: %+v, %v", report, err)
+				}
+			}
+			activity, err := stores.Activities.GetByExternalID(activities[0]["id"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if activity.EventID == nil || *activity.EventID != event.ID {
+				t.Errorf("activity event %v, want imported event %s", activity.EventID, event.ID)
+			}
+		})
+	}
+}
+
+func TestImportTimes(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 11, 2, 9, 30, 0, 0, ist)
+	for _, in := range []string{"2026-11-02T09:30:00+05:30", "2026-11-02T04:00:00Z", " 2026-11-02T09:30 "} {
+		if got, err := parseImportTime(in, ist); err != nil || !got.Equal(want) {
+			t.Errorf("parseImportTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+
+	report, err := importRecords(newMemoryStores(), ist, "events", []map[string]string{
+		{"external_id": "fest-2026", "title": "Tech fest", "event_date": "02/11/2026 09:30"},
+	}, true)
+	if err != nil || len(report.Rows) != 1 || len(report.Rows[0].Errors) != 1 {
+		t.Fatalf("report %+v, %v", report, err)
+	}
+	msg := report.Rows[0].Errors[0]
+	for _, part := range []string{"event_date", "RFC 3339", "2026-11-02T09:30,", "Asia/Kolkata"} {
+		if !strings.Contains(msg, part) {
+			t.Errorf("error %q does not mention %q", msg, part)
+		}
+	}
+}
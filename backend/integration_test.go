@@ -0,0 +1,549 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		user := ts.register("1js21cs001", "")
+		if user.Token == "" || user.USN != "1JS21CS001" || user.Role != "user" {
+			t.Fatalf("registered %+v", user)
+		}
+		if user.AdmissionYear != 2021 || user.Branch != "CS" {
+			t.Errorf("admission year %d, branch %q", user.AdmissionYear, user.Branch)
+		}
+
+		ts.mustDo(http.StatusConflict, http.MethodPost, "/api/register", "", map[string]string{"usn": "1JS21CS001"}, nil)
+		ts.mustDo(http.StatusBadRequest, http.MethodPost, "/api/register", "", map[string]string{"usn": "not-a-usn"}, nil)
+
+		var login struct {
+			Token string `json:"token"`
+			User  User   `json:"user"`
+		}
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/login", "", map[string]string{"usn": " 1js21-cs001"}, &login)
+		if login.User.ID != user.ID || login.Token == "" {
+			t.Errorf("logged in as %+v", login.User)
+		}
+		ts.mustDo(http.StatusNotFound, http.MethodPost, "/api/login", "", map[string]string{"usn": "1JS21CS999"}, nil)
+
+		var profile User
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/profile", login.Token, nil, &profile)
+		if profile.ID != user.ID {
+			t.Errorf("profile of %s, want %s", profile.ID, user.ID)
+		}
+		ts.mustDo(http.StatusUnauthorized, http.MethodGet, "/api/profile", "", nil, nil)
+	})
+}
+
+func TestRoomChat(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+
+		input := map[string]interface{}{"title": "Standup", "timer_minutes": 10}
+		ts.mustDo(http.StatusForbidden, http.MethodPost, "/api/rooms", alice.Token, input, nil)
+		var room Room
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/rooms", admin.Token, input, &room)
+
+		var rooms []Room
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/rooms", "", nil, &rooms)
+		if len(rooms) != 1 || rooms[0].ID != room.ID {
+			t.Fatalf("open rooms %+v", rooms)
+		}
+
+		aliceConn, _ := ts.dialRoom(room.ID, alice)
+		say(t, aliceConn, "alice joined")
+		bobConn, _ := ts.dialRoom(room.ID, bob)
+		say(t, bobConn, "bob joined")
+		if msg := readChatMessage(t, aliceConn); msg.Content != "bob joined" {
+			t.Fatalf("alice got %q", msg.Content)
+		}
+
+		if err := aliceConn.WriteMessage(websocket.TextMessage, []byte("hello bob")); err != nil {
+			t.Fatal(err)
+		}
+		msg := readChatMessage(t, bobConn)
+		if msg.Content != "hello bob" || msg.UserID != alice.ID || msg.UserUSN != alice.USN || msg.RoomID != room.ID {
+			t.Fatalf("bob got %+v", msg)
+		}
+		if msg := readChatMessage(t, aliceConn); msg.Content != "hello bob" {
+			t.Fatalf("alice got %q", msg.Content)
+		}
+
+		// Newcomers get the history first, oldest first.
+		lateConn, _ := ts.dialRoom(room.ID, admin)
+		for _, want := range []string{"alice joined", "bob joined", "hello bob"} {
+			if got := readChatMessage(t, lateConn).Content; got != want {
+				t.Fatalf("history has %q, want %q", got, want)
+			}
+		}
+
+		ts.mustDo(http.StatusForbidden, http.MethodPost, "/api/rooms/close", alice.Token, map[string]string{"room_id": room.ID}, nil)
+		ts.mustDo(http.StatusNoContent, http.MethodPost, "/api/rooms/close", admin.Token, map[string]string{"room_id": room.ID}, nil)
+		if _, status := ts.dialRoom(room.ID, bob); status != http.StatusGone {
+			t.Errorf("joining a closed room: status %d, want %d", status, http.StatusGone)
+		}
+		if _, status := ts.dialRoom("000000x", bob); status != http.StatusNotFound {
+			t.Errorf("joining an unknown room: status %d, want %d", status, http.StatusNotFound)
+		}
+	})
+}
+
+func TestForgedTokenCannotSeeRestrictedEvents(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		var group Group
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/groups", admin.Token, map[string]string{"name": "Core", "join_policy": "invite"}, &group)
+		input := map[string]interface{}{
+			"title":      "Core team sync",
+			"event_date": time.Now().Add(48 * time.Hour),
+			"group_ids":  []uuid.UUID{group.ID},
+		}
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, input, nil)
+
+		forge := func(claims jwt.MapClaims) string {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("not-the-server-secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+		for name, token := range map[string]string{
+			"admin role":  forge(jwt.MapClaims{"role": "admin"}),
+			"member id":   forge(jwt.MapClaims{"id": admin.ID.String(), "role": "user"}),
+			"no role":     forge(jwt.MapClaims{}),
+			"not a token": "garbage",
+			"unsigned":    "eyJhbGciOiJub25lIn0.eyJyb2xlIjoiYWRtaW4ifQ.",
+		} {
+			var events []Event
+			ts.mustDo(http.StatusOK, http.MethodGet, "/api/events", token, nil, &events)
+			if len(events) != 0 {
+				t.Errorf("%s: forged token sees %d restricted events", name, len(events))
+			}
+		}
+
+		var events []Event
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/events", admin.Token, nil, &events)
+		if len(events) != 1 {
+			t.Fatalf("admin sees %d events, want 1", len(events))
+		}
+	})
+}
+
+func TestHubShutdownClosesWebSockets(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		var room Room
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/rooms", admin.Token, map[string]interface{}{"title": "Standup", "timer_minutes": 10}, &room)
+
+		conn, _ := ts.dialRoom(room.ID, alice)
+		say(t, conn, "hello")
+		ts.stopHub()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("read after shutdown: %v, want close 1001", err)
+		}
+	})
+}
+
+func TestEventRegistrationAndCheckIn(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		user := ts.register("1JS21CS001", "")
+
+		eventInput := map[string]interface{}{
+			"title":      "Hackathon",
+			"event_date": time.Now().Add(48 * time.Hour),
+			"capacity":   50,
+		}
+		ts.mustDo(http.StatusForbidden, http.MethodPost, "/api/events", user.Token, eventInput, nil)
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, eventInput, &event)
+
+		var events []Event
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/events", user.Token, nil, &events)
+		if len(events) != 1 || events[0].ID != event.ID {
+			t.Fatalf("events %+v", events)
+		}
+
+		var reg Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", user.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+		if reg.Status != "registered" || reg.QRCodeToken == "" || reg.UserID != user.ID {
+			t.Fatalf("registration %+v", reg)
+		}
+		ts.mustDo(http.StatusConflict, http.MethodPost, "/api/events/register", user.Token, map[string]interface{}{"event_id": event.ID}, nil)
+		ts.mustDo(http.StatusNotFound, http.MethodPost, "/api/events/register", user.Token, map[string]interface{}{"event_id": uuid.New()}, nil)
+
+		checkIn := func(token string, toggle bool) map[string]interface{} {
+			return map[string]interface{}{"qr_code_token": token, "toggle": toggle}
+		}
+		ts.mustDo(http.StatusForbidden, http.MethodPost, "/api/events/checkin", user.Token, checkIn(reg.QRCodeToken, false), nil)
+		ts.mustDo(http.StatusNotFound, http.MethodPost, "/api/events/checkin", admin.Token, checkIn("no-such-token", false), nil)
+
+		var scanned Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin", admin.Token, checkIn(reg.QRCodeToken, false), &scanned)
+		if scanned.Status != "checked_in" || scanned.CheckedInAt == nil {
+			t.Fatalf("after check-in %+v", scanned)
+		}
+		ts.mustDo(http.StatusConflict, http.MethodPost, "/api/events/checkin", admin.Token, checkIn(reg.QRCodeToken, false), nil)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin", admin.Token, checkIn(reg.QRCodeToken, true), &scanned)
+		if scanned.Status != "checked_out" || scanned.CheckedOutAt == nil {
+			t.Fatalf("after check-out %+v", scanned)
+		}
+
+		resp, err := http.Get(ts.URL + "/api/events/export?event_id=" + event.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("export without a token: status %d", resp.StatusCode)
+		}
+		ts.mustDo(http.StatusOK, http.MethodPatch, "/api/profile", user.Token, map[string]string{"name": "=HYPERLINK(1)"}, nil)
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/events/export?event_id="+event.ID.String(), nil)
+		req.Header.Set("Authorization", admin.Token)
+		resp, err = ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), user.USN) || !strings.Contains(string(body), "checked_out") ||
+			!strings.Contains(string(body), ",'=HYPERLINK(1),") {
+			t.Errorf("export: status %d, body %q", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestOfflineCheckInSync(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{"title": "Hackathon", "event_date": time.Now()}, &event)
+		var aliceReg, bobReg Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", alice.Token, map[string]interface{}{"event_id": event.ID}, &aliceReg)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", bob.Token, map[string]interface{}{"event_id": event.ID}, &bobReg)
+
+		// Alice came and left while the scanner was online.
+		toggle := map[string]interface{}{"qr_code_token": aliceReg.QRCodeToken, "toggle": true}
+		var left Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin", admin.Token, toggle, nil)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin", admin.Token, toggle, &left)
+
+		sync := func(scans ...offlineScan) map[string]string {
+			var resp struct {
+				Results []offlineScanResult `json:"results"`
+			}
+			ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/checkin/sync", admin.Token, map[string]interface{}{"event_id": event.ID, "scans": scans}, &resp)
+			results := map[string]string{}
+			for _, res := range resp.Results {
+				results[res.QRCodeToken] = res.Result
+			}
+			return results
+		}
+		results := sync(
+			offlineScan{QRCodeToken: bobReg.QRCodeToken, ScannedAt: time.Now().Add(-time.Hour), DeviceID: "gate-1"},
+			offlineScan{QRCodeToken: aliceReg.QRCodeToken, ScannedAt: left.CheckedOutAt.Add(time.Minute), DeviceID: "gate-1"},
+		)
+		if results[bobReg.QRCodeToken] != scanCheckedIn || results[aliceReg.QRCodeToken] != scanCheckedIn {
+			t.Fatalf("sync results %v", results)
+		}
+		// Replaying the batch changes nothing.
+		results = sync(offlineScan{QRCodeToken: aliceReg.QRCodeToken, ScannedAt: left.CheckedOutAt.Add(time.Minute), DeviceID: "gate-1"})
+		if results[aliceReg.QRCodeToken] != scanAlreadyCheckedIn {
+			t.Fatalf("replayed sync results %v", results)
+		}
+
+		var report []attendanceReport
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/events/attendance?event_id="+event.ID.String(), admin.Token, nil, &report)
+		var aliceReport attendanceReport
+		for _, rep := range report {
+			if rep.UserUSN == alice.USN {
+				aliceReport = rep
+			}
+		}
+		if len(aliceReport.Sessions) != 2 || !aliceReport.Inside {
+			t.Errorf("alice's attendance %+v, want a second, open session", aliceReport)
+		}
+	})
+}
+
+func TestCheckInStream(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		user := ts.register("1JS21CS001", "")
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{"title": "Hackathon", "event_date": time.Now().Add(48 * time.Hour)}, &event)
+		var reg Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", user.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/checkins?token=" + admin.Token + "&event_id=" + event.ID.String()
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		read := func() checkInUpdate {
+			t.Helper()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var update checkInUpdate
+			if err := conn.ReadJSON(&update); err != nil {
+				t.Fatal(err)
+			}
+			return update
+		}
+		if snapshot := read(); snapshot.Type != "snapshot" || snapshot.Stats.Registered != 1 {
+			t.Fatalf("snapshot %+v", snapshot)
+		}
+
+		// The stream joins the hub just after the snapshot, so keep toggling
+		// the attendee in and out until an update arrives.
+		done := make(chan struct{})
+		var scanner sync.WaitGroup
+		scanner.Add(1)
+		defer func() {
+			close(done)
+			scanner.Wait()
+		}()
+		go func() {
+			defer scanner.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					ts.do(http.MethodPost, "/api/events/checkin", admin.Token, map[string]interface{}{"qr_code_token": reg.QRCodeToken, "toggle": true}, nil)
+					time.Sleep(20 * time.Millisecond)
+				}
+			}
+		}()
+		update := read()
+		if update.Type != "update" || update.Scan == nil || update.Scan.UserUSN != user.USN || update.Stats.CheckedIn != 1 {
+			t.Fatalf("update %+v", update)
+		}
+	})
+}
+
+func TestActivityRegistration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+
+		start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+		newActivity := func(title string, offset time.Duration, capacity int) Activity {
+			t.Helper()
+			var activity Activity
+			ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities", admin.Token, map[string]interface{}{
+				"title":      title,
+				"start_time": start.Add(offset),
+				"end_time":   start.Add(offset + time.Hour),
+				"capacity":   capacity,
+			}, &activity)
+			return activity
+		}
+		workshop := newActivity("Workshop", 0, 1)
+		talk := newActivity("Talk", 30*time.Minute, 0)
+		lunch := newActivity("Lunch", 90*time.Minute, 0) // Starts as the talk ends
+
+		register := func(user testUser, activity Activity, allowConflicts bool) (int, map[string]interface{}) {
+			t.Helper()
+			var out map[string]interface{}
+			status := ts.do(http.MethodPost, "/api/activities/register", user.Token, map[string]interface{}{
+				"activity_id":     activity.ID,
+				"allow_conflicts": allowConflicts,
+			}, &out)
+			return status, out
+		}
+
+		if status, _ := register(alice, workshop, false); status != http.StatusOK {
+			t.Fatalf("alice registering: status %d", status)
+		}
+		if status, _ := register(alice, workshop, false); status != http.StatusConflict {
+			t.Errorf("registering twice: status %d", status)
+		}
+		if status, _ := register(bob, workshop, false); status != http.StatusConflict {
+			t.Errorf("registering for a full activity: status %d", status)
+		}
+		if status, _ := register(alice, talk, false); status != http.StatusConflict {
+			t.Errorf("registering for an overlapping activity: status %d", status)
+		}
+		if status, out := register(alice, talk, true); status != http.StatusOK || out["conflicts"] == nil {
+			t.Errorf("registering despite the overlap: status %d, %v", status, out)
+		}
+		if status, out := register(alice, lunch, false); status != http.StatusOK || out["conflicts"] != nil {
+			t.Errorf("registering back to back: status %d, %v", status, out)
+		}
+
+		// Cancelling frees the place.
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities/cancel", alice.Token, map[string]interface{}{"activity_id": workshop.ID}, nil)
+		ts.mustDo(http.StatusNotFound, http.MethodPost, "/api/activities/cancel", alice.Token, map[string]interface{}{"activity_id": workshop.ID}, nil)
+		var reg ActivityRegistration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities/register", bob.Token, map[string]interface{}{"activity_id": workshop.ID}, &reg)
+		if reg.Status != "registered" || reg.QRCodeToken == nil {
+			t.Fatalf("bob's registration %+v", reg)
+		}
+
+		var scanned ActivityRegistration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities/checkin", admin.Token, map[string]string{"qr_code_token": *reg.QRCodeToken}, &scanned)
+		if scanned.Status != "checked_in" || scanned.CheckedInAt == nil {
+			t.Fatalf("after check-in %+v", scanned)
+		}
+		ts.mustDo(http.StatusConflict, http.MethodPost, "/api/activities/checkin", admin.Token, map[string]string{"qr_code_token": *reg.QRCodeToken}, nil)
+	})
+}
+
+func TestActivityCapacityUnderConcurrentRegistration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		var activity Activity
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities", admin.Token, map[string]interface{}{
+			"title":      "Escape room",
+			"start_time": time.Now().Add(time.Hour),
+			"end_time":   time.Now().Add(2 * time.Hour),
+			"capacity":   3,
+		}, &activity)
+
+		users := make([]testUser, 10)
+		for i := range users {
+			users[i] = ts.register(fmt.Sprintf("1JS21CS%03d", i+1), "")
+		}
+
+		statuses := make([]int, len(users))
+		var wg sync.WaitGroup
+		for i, user := range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses[i] = ts.do(http.MethodPost, "/api/activities/register", user.Token, map[string]interface{}{"activity_id": activity.ID}, nil)
+			}()
+		}
+		wg.Wait()
+
+		counts := map[int]int{}
+		for _, status := range statuses {
+			counts[status]++
+		}
+		if counts[http.StatusOK] != 3 || counts[http.StatusConflict] != 7 {
+			t.Errorf("statuses %v, want 3 OK and 7 conflicts", counts)
+		}
+	})
+}
+
+// slowTokenLookups pauses after every ticket lookup, so that concurrent
+// scans of one ticket all read it before any of them writes unless
+// something serializes them.
+type slowTokenLookups struct{ RegistrationStore }
+
+func (s slowTokenLookups) GetByToken(token string) (Registration, error) {
+	reg, err := s.RegistrationStore.GetByToken(token)
+	time.Sleep(20 * time.Millisecond)
+	return reg, err
+}
+
+func (s slowTokenLookups) GetActivityByToken(token string) (ActivityRegistration, error) {
+	reg, err := s.RegistrationStore.GetActivityByToken(token)
+	time.Sleep(20 * time.Millisecond)
+	return reg, err
+}
+
+// TestConcurrentScansOfOneTicket has several door scanners read the same
+// ticket at once: only one of them may check it in, and toggles must pair
+// every check-out with a check-in.
+func TestConcurrentScansOfOneTicket(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			stores := backend.stores(t)
+			stores.Registrations = slowTokenLookups{stores.Registrations}
+			testConcurrentScansOfOneTicket(t, newTestServer(t, stores))
+		})
+	}
+}
+
+func testConcurrentScansOfOneTicket(t *testing.T, ts *testServer) {
+	admin := ts.register("1JS20CS100", "admin")
+	alice := ts.register("1JS21CS001", "")
+	var event Event
+	ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{
+		"title": "Hackathon", "event_date": time.Now().Add(time.Hour),
+	}, &event)
+	var reg Registration
+	ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", alice.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+	start := time.Now().Add(time.Hour).Truncate(time.Hour)
+	var activity Activity
+	ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities", admin.Token, map[string]interface{}{
+		"title": "Workshop", "start_time": start, "end_time": start.Add(time.Hour),
+	}, &activity)
+	var activityReg ActivityRegistration
+	ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities/register", alice.Token, map[string]interface{}{"activity_id": activity.ID}, &activityReg)
+
+	scanAll := func(n int, body map[string]interface{}) map[int]int {
+		statuses := make([]int, n)
+		var wg sync.WaitGroup
+		for i := range statuses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses[i] = ts.do(http.MethodPost, "/api/checkin/scan", admin.Token, body, nil)
+			}()
+		}
+		wg.Wait()
+		counts := map[int]int{}
+		for _, status := range statuses {
+			counts[status]++
+		}
+		return counts
+	}
+	sessions := func() []AttendanceSession {
+		var report []attendanceReport
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/events/attendance?event_id="+event.ID.String(), admin.Token, nil, &report)
+		if len(report) != 1 {
+			t.Fatalf("attendance %+v", report)
+		}
+		return report[0].Sessions
+	}
+
+	if counts := scanAll(10, map[string]interface{}{"qr_code_token": reg.QRCodeToken}); counts[http.StatusOK] != 1 || counts[http.StatusConflict] != 9 {
+		t.Errorf("event check-ins %v, want 1 OK and 9 conflicts", counts)
+	}
+	if got := sessions(); len(got) != 1 {
+		t.Errorf("%d sessions after one check-in", len(got))
+	}
+
+	// Ten toggles from inside: five check-outs, each followed by a
+	// check-in that opens a session, leaving alice inside.
+	if counts := scanAll(10, map[string]interface{}{"qr_code_token": reg.QRCodeToken, "toggle": true}); counts[http.StatusOK] != 10 {
+		t.Errorf("toggles %v, want 10 OK", counts)
+	}
+	got := sessions()
+	open := 0
+	for _, session := range got {
+		if session.CheckedOutAt == nil {
+			open++
+		}
+	}
+	if len(got) != 6 || open != 1 {
+		t.Errorf("%d sessions, %d open; want 6 with the last one open", len(got), open)
+	}
+
+	if counts := scanAll(10, map[string]interface{}{"qr_code_token": *activityReg.QRCodeToken}); counts[http.StatusOK] != 1 || counts[http.StatusConflict] != 9 {
+		t.Errorf("activity check-ins %v, want 1 OK and 9 conflicts", counts)
+	}
+}
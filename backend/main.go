@@ -1,51 +1,61 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
-	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var (
-	DB        *gorm.DB
-	JWTSecret = []byte("your-secret-key") // In production, use environment variable
-	upgrader  = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
-	}
-)
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
 
-func initDB() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found, using system env")
+// openDB connects to cfg.DatabaseURL without touching the schema.
+// cfg.DBDriver picks the database: postgres or sqlite, for which the URL is
+// a file name.
+func openDB(cfg Config) (*gorm.DB, error) {
+	if err := cfg.validateDatabase(); err != nil {
+		return nil, err
 	}
-
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		// Default for local development
-		dsn = "host=localhost user=postgres password=Strawteddy12 dbname=jssrooms port=5432 sslmode=disable"
+	var dialector gorm.Dialector
+	switch cfg.DBDriver {
+	case "postgres":
+		dialector = postgres.Open(cfg.DatabaseURL)
+	case "sqlite":
+		var err error
+		if dialector, err = openSQLite(cfg.DatabaseURL); err != nil {
+			return nil, err
+		}
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError turns constraint violations into gorm.ErrDuplicatedKey
+	// and gorm.ErrForeignKeyViolated.
+	return gorm.Open(dialector, &gorm.Config{TranslateError: true})
+}
+
+// initDB connects and checks that the schema is fully migrated.
+func initDB(cfg Config) *gorm.DB {
+	db, err := openDB(cfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-
-	DB = db
-	if err := db.AutoMigrate(&User{}, &Room{}, &Message{}, &Event{}, &Registration{}, &Activity{}, &ActivityRegistration{}); err != nil {
-		log.Printf("Migration Failed: %v", err)
+	if err := checkMigrations(db); err != nil {
+		log.Fatal("Database schema is not up to date: ", err)
 	}
-	fmt.Println("Database migrated successfully")
+	return db
 }
 
 // WebSocket Hub
@@ -56,26 +66,43 @@ type Client struct {
 	Room string
 }
 
+// Notification is a pre-encoded payload pushed to every client of a hub room.
+// Non-chat streams (e.g. live check-in stats) use it instead of Broadcast.
+type Notification struct {
+	Room    string
+	Payload []byte
+}
+
 type Hub struct {
 	Rooms      map[string]map[*Client]bool
 	Broadcast  chan Message
+	Notify     chan Notification
 	Register   chan *Client
 	Unregister chan *Client
 	mu         sync.Mutex
+	done       chan struct{} // Closed when run returns
 }
 
 func newHub() *Hub {
 	return &Hub{
 		Rooms:      make(map[string]map[*Client]bool),
 		Broadcast:  make(chan Message),
+		Notify:     make(chan Notification),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		done:       make(chan struct{}),
 	}
 }
 
-func (h *Hub) run() {
+// run serves the hub until ctx is cancelled, then sends every client a
+// close frame.
+func (h *Hub) run(ctx context.Context) {
+	defer close(h.done)
 	for {
 		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
 		case client := <-h.Register:
 			h.mu.Lock()
 			if h.Rooms[client.Room] == nil {
@@ -103,109 +130,161 @@ func (h *Hub) run() {
 				}
 			}
 			h.mu.Unlock()
+		case n := <-h.Notify:
+			h.mu.Lock()
+			for client := range h.Rooms[n.Room] {
+				select {
+				case client.Send <- n.Payload:
+				default:
+					close(client.Send)
+					delete(h.Rooms[n.Room], client)
+				}
+			}
+			h.mu.Unlock()
 		}
 	}
 }
 
-var hub *Hub
-
-func main() {
-	initDB()
-	go startRoomCleanupTicker()
-	hub = newHub()
-	go hub.run()
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/login", handleLogin)
-	mux.HandleFunc("/api/register", handleRegister)
-	mux.HandleFunc("/api/rooms", handleRooms)
-	mux.HandleFunc("/api/rooms/close", adminMiddleware(handleCloseRoom))
-	mux.HandleFunc("/api/events", handleEvents) // We'll handle role check inside here for GET/POST mix
-	mux.HandleFunc("/api/events/register", authMiddleware(handleEventRegister))
-	mux.HandleFunc("/api/events/registrations", authMiddleware(handleEventRegistrations))
-	mux.HandleFunc("/api/events/checkin", adminMiddleware(handleEventCheckIn))
-	mux.HandleFunc("/api/profile", authMiddleware(handleProfile))
-	mux.HandleFunc("/api/groups", authMiddleware(handleGroups))
-	mux.HandleFunc("/api/activities", handleActivities)
-	mux.HandleFunc("/api/activities/register", authMiddleware(handleActivityRegister))
-	mux.HandleFunc("/ws", handleWebSocket)
-
-	// Simple CORS wrapper
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-
-		if r.Method == "OPTIONS" {
-			return
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	goingAway := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for room, clients := range h.Rooms {
+		for client := range clients {
+			client.Conn.WriteControl(websocket.CloseMessage, goingAway, time.Now().Add(time.Second))
+			close(client.Send)
 		}
+		delete(h.Rooms, room)
+	}
+}
 
-		mux.ServeHTTP(w, r)
-	})
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// register, unregister, broadcast and notify hand work to run. Once the
+// hub has stopped they return at once instead of blocking; register then
+// reports false.
+func (h *Hub) register(client *Client) bool {
+	select {
+	case h.Register <- client:
+		return true
+	case <-h.done:
+		return false
 	}
+}
 
-	fmt.Printf("Server starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+func (h *Hub) unregister(client *Client) {
+	select {
+	case h.Unregister <- client:
+	case <-h.done:
+	}
 }
 
-func startRoomCleanupTicker() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+func (h *Hub) broadcast(msg Message) {
+	select {
+	case h.Broadcast <- msg:
+	case <-h.done:
+	}
+}
 
-	for range ticker.C {
-		result := DB.Model(&Room{}).Where("is_closed = ? AND expires_at < ?", false, time.Now()).Update("is_closed", true)
-		if result.Error != nil {
-			log.Printf("Error closing expired rooms: %v", result.Error)
-		} else if result.RowsAffected > 0 {
-			log.Printf("Closed %d expired rooms", result.RowsAffected)
-		}
+func (h *Hub) notify(n Notification) {
+	select {
+	case h.Notify <- n:
+	case <-h.done:
 	}
 }
 
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImportCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return JWTSecret, nil
-		})
+	cfg, printConfig, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if printConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	db := initDB(cfg)
+	hub := newHub()
+	server := newServer(cfg, newGormStores(db), hub, initStorage(cfg))
 
-		next.ServeHTTP(w, r)
+	background, stopBackground := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	for _, job := range []func(context.Context){hub.run, server.startRoomCleanupTicker, server.runCheckInPublisher} {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(background)
+		}()
+	}
+
+	httpServer := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      server.Handler(),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.ListenAndServe() }()
+	fmt.Printf("Server starting on port %s...\n", cfg.Port)
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-signals.Done():
+	}
+	// A second signal kills the process the default way.
+	stopSignals()
+	log.Println("Shutting down...")
+
+	// Stop accepting connections and let in-flight requests finish, then
+	// close the WebSockets (hijacked, so Shutdown leaves them alone) and
+	// stop the background jobs.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Println("Requests still running at shutdown timeout:", err)
+	}
+	stopBackground()
+	jobs.Wait()
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	log.Println("Server stopped")
 }
 
-func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
+		if s.tokenClaims(r) == nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return JWTSecret, nil
-		})
+		next.ServeHTTP(w, r)
+	}
+}
 
-		if err != nil || !token.Valid {
+func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := s.tokenClaims(r)
+		if claims == nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["role"] != "admin" {
+		if claims["role"] != "admin" {
 			http.Error(w, "Forbidden: Admin access only", http.StatusForbidden)
 			return
 		}
@@ -213,3 +292,12 @@ func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	}
 }
+
+// longWrite gives next's response LongWriteTimeout instead of the server's
+// WriteTimeout, for handlers that render or stream large bodies.
+func (s *Server) longWrite(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(s.config.LongWriteTimeout))
+		next.ServeHTTP(w, r)
+	}
+}
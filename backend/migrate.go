@@ -0,0 +1,321 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema changes live in migrations/<dialect>/ as numbered pairs of SQL
+// files, NNNN_name.up.sql and NNNN_name.down.sql. Every dialect has the same
+// versions, written in its own SQL. Applied versions are recorded in
+// schema_migrations; each migration runs in a transaction together with
+// that bookkeeping, so a failed one leaves the schema where it was.
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// loadMigrations reads the embedded migrations for db's dialect in version
+// order.
+func loadMigrations(db *gorm.DB) ([]migration, error) {
+	dir := path.Join("migrations", db.Dialector.Name())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.%s.sql", name, direction)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]schemaMigration, error) {
+	applied := map[int]schemaMigration{}
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return applied, nil
+	}
+	var rows []schemaMigration
+	if err := db.Order("version asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// pendingMigrations returns the migrations not applied yet. It fails if the
+// database has versions this binary doesn't know, i.e. it was migrated by
+// a newer build.
+func pendingMigrations(db *gorm.DB) ([]migration, error) {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]bool{}
+	var pending []migration
+	for _, m := range migrations {
+		known[m.Version] = true
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %d, which this build doesn't know about", version)
+		}
+	}
+	return pending, nil
+}
+
+// checkMigrations is run at startup: the server only starts against a
+// database whose schema is exactly what this build expects.
+func checkMigrations(db *gorm.DB) error {
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migration(s), starting with %04d_%s; run `backend migrate up`", len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// migrateUp applies pending migrations in order, stopping at target when it
+// is positive.
+func migrateUp(db *gorm.DB, target int) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	if err := adoptLegacySchema(db); err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// migrateDown rolls back the latest steps applied migrations.
+func migrateDown(db *gorm.DB, steps int) error {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %04d_%s can't be rolled back: no down file", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rolling back %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// adoptLegacySchema brings a database that was managed by AutoMigrate, before
+// versioned migrations existed, up to the initial schema and records that
+// migration as applied instead of running it. It all happens in one
+// transaction, so a failed backfill leaves the database to be adopted again.
+func adoptLegacySchema(db *gorm.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 || !db.Migrator().HasTable(&User{}) {
+		return nil
+	}
+
+	log.Println("Adopting database created by AutoMigrate")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := prepareActivityEventLinks(tx); err != nil {
+			return err
+		}
+		if err := tx.AutoMigrate(&User{}, &Group{}, &GroupMembership{}, &GroupJoinRequest{}, &Room{}, &Message{}, &Series{}, &Event{}, &Registration{}, &AttendanceSession{}, &Activity{}, &ActivityRegistration{}); err != nil {
+			return fmt.Errorf("bringing legacy schema up to date: %w", err)
+		}
+		if err := backfillActivityCheckInTokens(tx); err != nil {
+			return err
+		}
+		if err := migrateGroupMemberships(tx); err != nil {
+			return err
+		}
+		if err := backfillUSNDetails(tx); err != nil {
+			return err
+		}
+		return tx.Create(&schemaMigration{Version: 1, Name: "initial_schema", AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("adopting legacy schema: %w", err)
+	}
+	return nil
+}
+
+func printMigrationStatus(db *gorm.DB) error {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		status := "pending"
+		if row, ok := applied[m.Version]; ok {
+			status = "applied " + row.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%04d_%-40s %s\n", m.Version, m.Name, status)
+	}
+	return nil
+}
+
+// runMigrateCommand implements `backend migrate [up [VERSION] | down [STEPS] | status]`.
+func runMigrateCommand(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: backend migrate [config flags] up [VERSION] | down [STEPS] | status")
+		fs.PrintDefaults()
+	}
+	config := configFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := config.load()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	db, err := openDB(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	action := fs.Arg(0)
+	n := 0
+	if fs.NArg() > 1 {
+		if n, err = strconv.Atoi(fs.Arg(1)); err != nil || n < 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	switch action {
+	case "", "up":
+		err = migrateUp(db, n)
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		err = migrateDown(db, n)
+	case "status":
+		err = printMigrationStatus(db)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAdoptLegacySchemaFailure checks that a backfill failing partway
+// through leaves the legacy database unadopted and untouched, so the next
+// run starts over.
+func TestAdoptLegacySchemaFailure(t *testing.T) {
+	db := emptySQLiteTestDB(t)
+	if err := db.AutoMigrate(&User{}, &Event{}, &Activity{}, &ActivityRegistration{}); err != nil {
+		t.Fatal(err)
+	}
+	user := User{USN: "1js21cs001"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC)
+	activity := Activity{Title: "Lab", StartTime: start, EndTime: start.Add(time.Hour)}
+	if err := db.Create(&activity).Error; err != nil {
+		t.Fatal(err)
+	}
+	reg := ActivityRegistration{ActivityID: activity.ID, UserID: user.ID}
+	if err := db.Create(&reg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&reg).Update("qr_code_token", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The USN backfill runs after the check-in tokens are issued.
+	if err := db.Exec("CREATE TRIGGER users_read_only BEFORE UPDATE ON users BEGIN SELECT RAISE(ABORT, 'users are read-only'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUp(db, 0); err == nil {
+		t.Fatal("migrated despite a failed backfill")
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("applied %v, %v", applied, err)
+	}
+	var got ActivityRegistration
+	if err := db.First(&got, "id = ?", reg.ID).Error; err != nil || got.QRCodeToken != nil {
+		t.Fatalf("token %v kept after the adoption failed, %v", got.QRCodeToken, err)
+	}
+
+	if err := db.Exec("DROP TRIGGER users_read_only").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	var adopted User
+	if err := db.First(&adopted, "id = ?", user.ID).Error; err != nil || adopted.USN != "1JS21CS001" {
+		t.Errorf("USN %q after adoption, %v", adopted.USN, err)
+	}
+	if err := db.First(&got, "id = ?", reg.ID).Error; err != nil || got.QRCodeToken == nil {
+		t.Errorf("no check-in token after adoption, %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS "activity_groups";
+DROP TABLE IF EXISTS "event_groups";
+DROP TABLE IF EXISTS "activity_registrations";
+DROP TABLE IF EXISTS "activities";
+DROP TABLE IF EXISTS "attendance_sessions";
+DROP TABLE IF EXISTS "registrations";
+DROP TABLE IF EXISTS "events";
+DROP TABLE IF EXISTS "series";
+DROP TABLE IF EXISTS "messages";
+DROP TABLE IF EXISTS "rooms";
+DROP TABLE IF EXISTS "group_join_requests";
+DROP TABLE IF EXISTS "group_memberships";
+DROP TABLE IF EXISTS "groups";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,195 @@
+-- Schema as of the switch from AutoMigrate to versioned migrations.
+
+CREATE TABLE "users" (
+    "id" uuid,
+    "usn" text NOT NULL,
+    "admission_year" bigint,
+    "branch" text,
+    "name" text,
+    "bio" text,
+    "role" text DEFAULT 'user',
+    "profile_image" text,
+    "calendar_token" text,
+    "privacy_listed_in_directory" boolean DEFAULT true,
+    "privacy_show_groups" boolean DEFAULT true,
+    "privacy_show_attendance" boolean DEFAULT false,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_calendar_token" ON "users" ("calendar_token");
+CREATE INDEX IF NOT EXISTS "idx_users_branch" ON "users" ("branch");
+CREATE INDEX IF NOT EXISTS "idx_users_admission_year" ON "users" ("admission_year");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_usn" ON "users" ("usn");
+
+CREATE TABLE "groups" (
+    "id" uuid,
+    "name" text NOT NULL,
+    "description" text,
+    "owner_id" uuid,
+    "join_policy" text DEFAULT 'approval',
+    "invite_code" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_groups_invite_code" ON "groups" ("invite_code");
+
+CREATE TABLE "group_memberships" (
+    "id" uuid,
+    "group_id" uuid,
+    "user_id" uuid,
+    "role" text DEFAULT 'member',
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_group_memberships_group" FOREIGN KEY ("group_id") REFERENCES "groups"("id"),
+    CONSTRAINT "fk_users_memberships" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_group_memberships_user_id" ON "group_memberships" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_group_member" ON "group_memberships" ("group_id","user_id");
+
+CREATE TABLE "group_join_requests" (
+    "id" uuid,
+    "group_id" uuid,
+    "user_id" uuid,
+    "status" text DEFAULT 'pending',
+    "decided_by" uuid,
+    "decided_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_group_join_requests_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_group_join_requests_user_id" ON "group_join_requests" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_group_join_requests_group_id" ON "group_join_requests" ("group_id");
+
+CREATE TABLE "rooms" (
+    "id" text,
+    "title" text NOT NULL,
+    "description" text,
+    "admin_id" uuid,
+    "timer_minutes" bigint,
+    "expires_at" timestamptz,
+    "is_closed" boolean DEFAULT false,
+    "group_id" uuid,
+    "created_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_rooms_deleted_at" ON "rooms" ("deleted_at");
+
+CREATE TABLE "messages" (
+    "id" uuid,
+    "room_id" text,
+    "user_id" uuid,
+    "user_usn" text,
+    "content" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_messages_room_id" ON "messages" ("room_id");
+
+CREATE TABLE "series" (
+    "id" uuid,
+    "kind" text NOT NULL,
+    "r_rule" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE "events" (
+    "id" uuid,
+    "external_id" text,
+    "title" text NOT NULL,
+    "description" text,
+    "category" text,
+    "image_url" text,
+    "location" text,
+    "capacity" bigint,
+    "organizer_id" uuid,
+    "event_date" timestamptz,
+    "series_id" uuid,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_events_series_id" ON "events" ("series_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_events_external_id" ON "events" ("external_id");
+
+CREATE TABLE "registrations" (
+    "id" uuid,
+    "event_id" uuid,
+    "user_id" uuid,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" timestamptz,
+    "checked_out_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_registrations_event" FOREIGN KEY ("event_id") REFERENCES "events"("id"),
+    CONSTRAINT "fk_registrations_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_registrations_qr_code_token" ON "registrations" ("qr_code_token");
+CREATE INDEX IF NOT EXISTS "idx_registrations_user_id" ON "registrations" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_registrations_event_id" ON "registrations" ("event_id");
+
+CREATE TABLE "attendance_sessions" (
+    "id" uuid,
+    "registration_id" uuid,
+    "checked_in_at" timestamptz,
+    "checked_out_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_attendance_sessions_registration_id" ON "attendance_sessions" ("registration_id");
+
+CREATE TABLE "activities" (
+    "id" uuid,
+    "external_id" text,
+    "event_id" uuid,
+    "title" text NOT NULL,
+    "description" text,
+    "image_url" text,
+    "location" text,
+    "capacity" bigint,
+    "start_time" timestamptz,
+    "end_time" timestamptz,
+    "series_id" uuid,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_events_activities" FOREIGN KEY ("event_id") REFERENCES "events"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_activities_series_id" ON "activities" ("series_id");
+CREATE INDEX IF NOT EXISTS "idx_activities_event_id" ON "activities" ("event_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_activities_external_id" ON "activities" ("external_id");
+
+CREATE TABLE "activity_registrations" (
+    "id" uuid,
+    "activity_id" uuid,
+    "user_id" uuid,
+    "user_usn" text,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_activity_registrations_activity" FOREIGN KEY ("activity_id") REFERENCES "activities"("id"),
+    CONSTRAINT "fk_users_activity_registrations" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_activity_registrations_qr_code_token" ON "activity_registrations" ("qr_code_token");
+CREATE INDEX IF NOT EXISTS "idx_activity_registrations_user_id" ON "activity_registrations" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_activity_registrations_activity_id" ON "activity_registrations" ("activity_id");
+
+CREATE TABLE "event_groups" (
+    "event_id" uuid,
+    "group_id" uuid,
+    PRIMARY KEY ("event_id","group_id"),
+    CONSTRAINT "fk_event_groups_event" FOREIGN KEY ("event_id") REFERENCES "events"("id"),
+    CONSTRAINT "fk_event_groups_group" FOREIGN KEY ("group_id") REFERENCES "groups"("id")
+);
+
+CREATE TABLE "activity_groups" (
+    "activity_id" uuid,
+    "group_id" uuid,
+    PRIMARY KEY ("activity_id","group_id"),
+    CONSTRAINT "fk_activity_groups_activity" FOREIGN KEY ("activity_id") REFERENCES "activities"("id"),
+    CONSTRAINT "fk_activity_groups_group" FOREIGN KEY ("group_id") REFERENCES "groups"("id")
+);
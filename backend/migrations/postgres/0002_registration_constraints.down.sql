@@ -0,0 +1,15 @@
+ALTER TABLE "messages"
+    DROP CONSTRAINT IF EXISTS "fk_messages_room",
+    ALTER COLUMN "room_id" DROP NOT NULL;
+
+DROP INDEX IF EXISTS "idx_activity_registrations_activity_user";
+CREATE INDEX IF NOT EXISTS "idx_activity_registrations_activity_id" ON "activity_registrations" ("activity_id");
+ALTER TABLE "activity_registrations"
+    ALTER COLUMN "activity_id" DROP NOT NULL,
+    ALTER COLUMN "user_id" DROP NOT NULL;
+
+DROP INDEX IF EXISTS "idx_registrations_event_user";
+CREATE INDEX IF NOT EXISTS "idx_registrations_event_id" ON "registrations" ("event_id");
+ALTER TABLE "registrations"
+    ALTER COLUMN "event_id" DROP NOT NULL,
+    ALTER COLUMN "user_id" DROP NOT NULL;
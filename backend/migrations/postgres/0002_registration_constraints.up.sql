@@ -0,0 +1,53 @@
+-- One registration per user per event and per activity, enforced by the
+-- database instead of a read-then-insert check, and messages tied to
+-- their room.
+
+-- Of each set of duplicates keep the one that got furthest (checked in over
+-- registered over cancelled), then the oldest.
+CREATE TEMPORARY TABLE "duplicate_registrations" ON COMMIT DROP AS
+SELECT "id" FROM (
+    SELECT "id", ROW_NUMBER() OVER (
+        PARTITION BY "event_id", "user_id"
+        ORDER BY "status" = 'cancelled', "checked_in_at" IS NULL, "created_at", "id"
+    ) AS "rank"
+    FROM "registrations"
+) AS "ranked"
+WHERE "rank" > 1;
+
+DELETE FROM "attendance_sessions" WHERE "registration_id" IN (SELECT "id" FROM "duplicate_registrations");
+DELETE FROM "registrations" WHERE "id" IN (SELECT "id" FROM "duplicate_registrations");
+DELETE FROM "registrations" WHERE "event_id" IS NULL OR "user_id" IS NULL;
+
+DELETE FROM "activity_registrations" WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", ROW_NUMBER() OVER (
+            PARTITION BY "activity_id", "user_id"
+            ORDER BY "status" = 'cancelled', "checked_in_at" IS NULL, "created_at", "id"
+        ) AS "rank"
+        FROM "activity_registrations"
+    ) AS "ranked"
+    WHERE "rank" > 1
+);
+DELETE FROM "activity_registrations" WHERE "activity_id" IS NULL OR "user_id" IS NULL;
+
+DELETE FROM "messages"
+WHERE "room_id" IS NULL
+   OR NOT EXISTS (SELECT 1 FROM "rooms" WHERE "rooms"."id" = "messages"."room_id");
+
+ALTER TABLE "registrations"
+    ALTER COLUMN "event_id" SET NOT NULL,
+    ALTER COLUMN "user_id" SET NOT NULL;
+DROP INDEX IF EXISTS "idx_registrations_event_id";
+CREATE UNIQUE INDEX "idx_registrations_event_user" ON "registrations" ("event_id", "user_id");
+
+ALTER TABLE "activity_registrations"
+    ALTER COLUMN "activity_id" SET NOT NULL,
+    ALTER COLUMN "user_id" SET NOT NULL;
+DROP INDEX IF EXISTS "idx_activity_registrations_activity_id";
+CREATE UNIQUE INDEX "idx_activity_registrations_activity_user" ON "activity_registrations" ("activity_id", "user_id");
+
+-- Messages can come from anonymous users in open rooms, so only the room
+-- is a foreign key.
+ALTER TABLE "messages"
+    ALTER COLUMN "room_id" SET NOT NULL,
+    ADD CONSTRAINT "fk_messages_room" FOREIGN KEY ("room_id") REFERENCES "rooms"("id");
@@ -0,0 +1,55 @@
+CREATE TABLE "messages_old" (
+    "id" text,
+    "room_id" text,
+    "user_id" text,
+    "user_usn" text,
+    "content" text NOT NULL,
+    "created_at" datetime,
+    PRIMARY KEY ("id")
+);
+INSERT INTO "messages_old" SELECT "id", "room_id", "user_id", "user_usn", "content", "created_at" FROM "messages";
+DROP TABLE "messages";
+ALTER TABLE "messages_old" RENAME TO "messages";
+CREATE INDEX "idx_messages_room_id" ON "messages" ("room_id");
+
+CREATE TABLE "activity_registrations_old" (
+    "id" text,
+    "activity_id" text,
+    "user_id" text,
+    "user_usn" text,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" datetime,
+    "created_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_activity_registrations_activity" FOREIGN KEY ("activity_id") REFERENCES "activities"("id"),
+    CONSTRAINT "fk_users_activity_registrations" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+INSERT INTO "activity_registrations_old"
+SELECT "id", "activity_id", "user_id", "user_usn", "qr_code_token", "status", "checked_in_at", "created_at" FROM "activity_registrations";
+DROP TABLE "activity_registrations";
+ALTER TABLE "activity_registrations_old" RENAME TO "activity_registrations";
+CREATE UNIQUE INDEX "idx_activity_registrations_qr_code_token" ON "activity_registrations" ("qr_code_token");
+CREATE INDEX "idx_activity_registrations_user_id" ON "activity_registrations" ("user_id");
+CREATE INDEX "idx_activity_registrations_activity_id" ON "activity_registrations" ("activity_id");
+
+CREATE TABLE "registrations_old" (
+    "id" text,
+    "event_id" text,
+    "user_id" text,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" datetime,
+    "checked_out_at" datetime,
+    "created_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_registrations_event" FOREIGN KEY ("event_id") REFERENCES "events"("id"),
+    CONSTRAINT "fk_registrations_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+INSERT INTO "registrations_old"
+SELECT "id", "event_id", "user_id", "qr_code_token", "status", "checked_in_at", "checked_out_at", "created_at" FROM "registrations";
+DROP TABLE "registrations";
+ALTER TABLE "registrations_old" RENAME TO "registrations";
+CREATE UNIQUE INDEX "idx_registrations_qr_code_token" ON "registrations" ("qr_code_token");
+CREATE INDEX "idx_registrations_user_id" ON "registrations" ("user_id");
+CREATE INDEX "idx_registrations_event_id" ON "registrations" ("event_id");
@@ -0,0 +1,94 @@
+-- One registration per user per event and per activity, enforced by the
+-- database instead of a read-then-insert check, and messages tied to
+-- their room. SQLite can't add NOT NULL or foreign keys to a table, so the
+-- three tables are rebuilt.
+
+-- Of each set of duplicates keep the one that got furthest (checked in over
+-- registered over cancelled), then the oldest.
+CREATE TEMPORARY TABLE "duplicate_registrations" AS
+SELECT "id" FROM (
+    SELECT "id", ROW_NUMBER() OVER (
+        PARTITION BY "event_id", "user_id"
+        ORDER BY "status" = 'cancelled', "checked_in_at" IS NULL, "created_at", "id"
+    ) AS "rank"
+    FROM "registrations"
+) AS "ranked"
+WHERE "rank" > 1;
+
+DELETE FROM "attendance_sessions" WHERE "registration_id" IN (SELECT "id" FROM "duplicate_registrations");
+DELETE FROM "registrations" WHERE "id" IN (SELECT "id" FROM "duplicate_registrations");
+DROP TABLE "duplicate_registrations";
+
+DELETE FROM "activity_registrations" WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", ROW_NUMBER() OVER (
+            PARTITION BY "activity_id", "user_id"
+            ORDER BY "status" = 'cancelled', "checked_in_at" IS NULL, "created_at", "id"
+        ) AS "rank"
+        FROM "activity_registrations"
+    ) AS "ranked"
+    WHERE "rank" > 1
+);
+
+CREATE TABLE "registrations_new" (
+    "id" text,
+    "event_id" text NOT NULL,
+    "user_id" text NOT NULL,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" datetime,
+    "checked_out_at" datetime,
+    "created_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_registrations_event" FOREIGN KEY ("event_id") REFERENCES "events"("id"),
+    CONSTRAINT "fk_registrations_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+INSERT INTO "registrations_new"
+SELECT "id", "event_id", "user_id", "qr_code_token", "status", "checked_in_at", "checked_out_at", "created_at"
+FROM "registrations" WHERE "event_id" IS NOT NULL AND "user_id" IS NOT NULL;
+DROP TABLE "registrations";
+ALTER TABLE "registrations_new" RENAME TO "registrations";
+CREATE UNIQUE INDEX "idx_registrations_qr_code_token" ON "registrations" ("qr_code_token");
+CREATE INDEX "idx_registrations_user_id" ON "registrations" ("user_id");
+CREATE UNIQUE INDEX "idx_registrations_event_user" ON "registrations" ("event_id", "user_id");
+
+CREATE TABLE "activity_registrations_new" (
+    "id" text,
+    "activity_id" text NOT NULL,
+    "user_id" text NOT NULL,
+    "user_usn" text,
+    "qr_code_token" text,
+    "status" text DEFAULT 'registered',
+    "checked_in_at" datetime,
+    "created_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_activity_registrations_activity" FOREIGN KEY ("activity_id") REFERENCES "activities"("id"),
+    CONSTRAINT "fk_users_activity_registrations" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+INSERT INTO "activity_registrations_new"
+SELECT "id", "activity_id", "user_id", "user_usn", "qr_code_token", "status", "checked_in_at", "created_at"
+FROM "activity_registrations" WHERE "activity_id" IS NOT NULL AND "user_id" IS NOT NULL;
+DROP TABLE "activity_registrations";
+ALTER TABLE "activity_registrations_new" RENAME TO "activity_registrations";
+CREATE UNIQUE INDEX "idx_activity_registrations_qr_code_token" ON "activity_registrations" ("qr_code_token");
+CREATE INDEX "idx_activity_registrations_user_id" ON "activity_registrations" ("user_id");
+CREATE UNIQUE INDEX "idx_activity_registrations_activity_user" ON "activity_registrations" ("activity_id", "user_id");
+
+-- Messages can come from anonymous users in open rooms, so only the room
+-- is a foreign key.
+CREATE TABLE "messages_new" (
+    "id" text,
+    "room_id" text NOT NULL,
+    "user_id" text,
+    "user_usn" text,
+    "content" text NOT NULL,
+    "created_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_messages_room" FOREIGN KEY ("room_id") REFERENCES "rooms"("id")
+);
+INSERT INTO "messages_new"
+SELECT "id", "room_id", "user_id", "user_usn", "content", "created_at"
+FROM "messages" WHERE "room_id" IN (SELECT "id" FROM "rooms");
+DROP TABLE "messages";
+ALTER TABLE "messages_new" RENAME TO "messages";
+CREATE INDEX "idx_messages_room_id" ON "messages" ("room_id");
@@ -11,22 +11,61 @@ import (
 
 type User struct {
 	ID                    uuid.UUID              `gorm:"type:uuid;primaryKey" json:"id"`
-	USN                   string                 `gorm:"uniqueIndex;not null" json:"usn"`
+	USN                   string                 `gorm:"uniqueIndex;not null" json:"usn"` // Normalized, see parseUSN
+	AdmissionYear         int                    `gorm:"index" json:"admission_year,omitempty"`
+	Branch                string                 `gorm:"index" json:"branch,omitempty"`
 	Name                  string                 `json:"name"`
 	Bio                   string                 `json:"bio"`
 	Role                  string                 `gorm:"default:'user'" json:"role"` // 'admin' or 'user'
-	GroupID               *uuid.UUID             `gorm:"type:uuid" json:"group_id"`
-	Group                 *Group                 `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	Memberships           []GroupMembership      `json:"memberships,omitempty"`
 	ProfileImage          string                 `json:"profile_image"`
+	CalendarToken         *string                `gorm:"uniqueIndex" json:"-"` // Secret for the personal iCalendar feed
+	Privacy               PrivacySettings        `gorm:"embedded;embeddedPrefix:privacy_" json:"privacy"`
 	CreatedAt             time.Time              `json:"created_at"`
+	UpdatedAt             time.Time              `json:"updated_at"`
 	ActivityRegistrations []ActivityRegistration `json:"activity_registrations,omitempty"`
 }
 
 type Group struct {
-	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Name        string     `gorm:"not null" json:"name"`
+	Description string     `json:"description"`
+	OwnerID     *uuid.UUID `gorm:"type:uuid" json:"owner_id"`
+	JoinPolicy  string     `gorm:"default:'approval'" json:"join_policy"` // 'open', 'approval' or 'invite'
+	InviteCode  *string    `gorm:"uniqueIndex" json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// PrivacySettings control what other users see of a profile. Admins and the
+// user themselves always see everything.
+type PrivacySettings struct {
+	ListedInDirectory bool `gorm:"default:true" json:"listed_in_directory"`
+	ShowGroups        bool `gorm:"default:true" json:"show_groups"`
+	ShowAttendance    bool `gorm:"default:false" json:"show_attendance"` // Opt-in list of attended events
+}
+
+// GroupMembership links a user to a group. Users may belong to any number of
+// groups, each with its own role.
+type GroupMembership struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	GroupID   uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_group_member" json:"group_id"`
+	Group     *Group    `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	UserID    uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_group_member;index" json:"user_id"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role      string    `gorm:"default:'member'" json:"role"` // 'owner', 'manager' or 'member'
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GroupJoinRequest struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	GroupID   uuid.UUID  `gorm:"type:uuid;index" json:"group_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	User      *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Status    string     `gorm:"default:'pending'" json:"status"` // 'pending', 'approved', 'rejected'
+	DecidedBy *uuid.UUID `gorm:"type:uuid" json:"decided_by"`
+	DecidedAt *time.Time `json:"decided_at"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 type Room struct {
@@ -44,7 +83,7 @@ type Room struct {
 
 type Message struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	RoomID    string    `gorm:"index" json:"room_id"` // Matches Room.ID string
+	RoomID    string    `gorm:"index" json:"room_id"` // Matches Room.ID string; foreign key fk_messages_room
 	UserID    uuid.UUID `gorm:"type:uuid" json:"user_id"`
 	UserUSN   string    `json:"user_usn"`
 	Content   string    `gorm:"not null" json:"content"`
@@ -52,50 +91,83 @@ type Message struct {
 }
 
 type Event struct {
-	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	Title       string    `gorm:"not null" json:"title"`
-	Description string    `json:"description"`
-	Category    string    `json:"category"`
-	ImageUrl    string    `json:"image_url"`
-	Location    string    `json:"location"`
-	Capacity    int       `json:"capacity"`
-	OrganizerID uuid.UUID `gorm:"type:uuid" json:"organizer_id"`
-	EventDate   time.Time `json:"event_date"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ExternalID  *string    `gorm:"uniqueIndex" json:"external_id,omitempty"` // Key used by bulk imports
+	Title       string     `gorm:"not null" json:"title"`
+	Description string     `json:"description"`
+	Category    string     `json:"category"`
+	ImageUrl    string     `json:"image_url"`
+	Location    string     `json:"location"`
+	Capacity    int        `json:"capacity"`
+	OrganizerID uuid.UUID  `gorm:"type:uuid" json:"organizer_id"`
+	EventDate   time.Time  `json:"event_date"`
+	SeriesID    *uuid.UUID `gorm:"type:uuid;index" json:"series_id,omitempty"` // Set on occurrences of a recurring event
+	CreatedAt   time.Time  `json:"created_at"`
+	Activities  []Activity `gorm:"foreignKey:EventID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"activities,omitempty"` // Agenda
+	Groups      []Group    `gorm:"many2many:event_groups" json:"groups,omitempty"`                                              // Members-only when set
+}
+
+// Series groups the occurrences generated from one recurrence rule.
+type Series struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Kind      string    `gorm:"not null" json:"kind"` // 'event' or 'activity'
+	RRule     string    `gorm:"not null" json:"rrule"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
+// Registration is a user's place at an event. The database allows one per
+// user and event (idx_registrations_event_user).
 type Registration struct {
-	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
-	EventID     uuid.UUID  `gorm:"type:uuid;index" json:"event_id"`
-	Event       *Event     `gorm:"foreignKey:EventID" json:"event,omitempty"`
-	UserID      uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
-	User        *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	QRCodeToken string     `gorm:"uniqueIndex" json:"qr_code_token"`
-	Status      string     `gorm:"default:'registered'" json:"status"` // 'registered', 'checked_in', 'cancelled'
-	CheckedInAt *time.Time `json:"checked_in_at"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	EventID      uuid.UUID  `gorm:"type:uuid;index" json:"event_id"`
+	Event        *Event     `gorm:"foreignKey:EventID" json:"event,omitempty"`
+	UserID       uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	User         *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	QRCodeToken  string     `gorm:"uniqueIndex" json:"qr_code_token"`
+	Status       string     `gorm:"default:'registered'" json:"status"` // 'registered', 'checked_in', 'checked_out', 'cancelled'
+	CheckedInAt  *time.Time `json:"checked_in_at"`                      // First entry
+	CheckedOutAt *time.Time `json:"checked_out_at"`                     // Latest exit
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// AttendanceSession is one entry/exit cycle of a registration at its event.
+type AttendanceSession struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	RegistrationID uuid.UUID  `gorm:"type:uuid;index" json:"registration_id"`
+	CheckedInAt    time.Time  `json:"checked_in_at"`
+	CheckedOutAt   *time.Time `json:"checked_out_at"` // nil while still inside
+	CreatedAt      time.Time  `json:"created_at"`
 }
 
 type Activity struct {
-	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	EventID     uuid.UUID `gorm:"type:uuid;index" json:"event_id"` // Optional: link to a parent event
-	Title       string    `gorm:"not null" json:"title"`
-	Description string    `json:"description"`
-	ImageUrl    string    `json:"image_url"`
-	Location    string    `json:"location"`
-	StartTime   time.Time `json:"start_time"`
-	EndTime     time.Time `json:"end_time"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ExternalID  *string    `gorm:"uniqueIndex" json:"external_id,omitempty"` // Key used by bulk imports
+	EventID     *uuid.UUID `gorm:"type:uuid;index" json:"event_id"`          // Optional: link to a parent event
+	Title       string     `gorm:"not null" json:"title"`
+	Description string     `json:"description"`
+	ImageUrl    string     `json:"image_url"`
+	Location    string     `json:"location"`
+	Capacity    int        `json:"capacity"` // 0 means unlimited
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	SeriesID    *uuid.UUID `gorm:"type:uuid;index" json:"series_id,omitempty"` // Set on occurrences of a recurring activity
+	CreatedAt   time.Time  `json:"created_at"`
+	Groups      []Group    `gorm:"many2many:activity_groups" json:"groups,omitempty"` // Members-only when set
 }
 
+// ActivityRegistration is a user's place at an activity, one per user and
+// activity like Registration.
 type ActivityRegistration struct {
-	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	ActivityID uuid.UUID `gorm:"type:uuid;index" json:"activity_id"`
-	Activity   *Activity `gorm:"foreignKey:ActivityID" json:"activity,omitempty"`
-	UserID     uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
-	UserUSN    string    `json:"user_usn"`
-	Status     string    `gorm:"default:'registered'" json:"status"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ActivityID  uuid.UUID  `gorm:"type:uuid;index" json:"activity_id"`
+	Activity    *Activity  `gorm:"foreignKey:ActivityID" json:"activity,omitempty"`
+	UserID      uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	User        *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	UserUSN     string     `json:"user_usn"`
+	QRCodeToken *string    `gorm:"uniqueIndex" json:"qr_code_token"`
+	Status      string     `gorm:"default:'registered'" json:"status"` // 'registered', 'checked_in', 'cancelled'
+	CheckedInAt *time.Time `json:"checked_in_at"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -108,6 +180,16 @@ func (g *Group) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+func (m *GroupMembership) BeforeCreate(tx *gorm.DB) (err error) {
+	m.ID = uuid.New()
+	return
+}
+
+func (jr *GroupJoinRequest) BeforeCreate(tx *gorm.DB) (err error) {
+	jr.ID = uuid.New()
+	return
+}
+
 func (r *Room) BeforeCreate(tx *gorm.DB) (err error) {
 	// Generate 6-digit numeric ID
 	r.ID = fmt.Sprintf("%06d", rand.Intn(1000000))
@@ -124,11 +206,21 @@ func (e *Event) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+func (s *Series) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New()
+	return
+}
+
 func (reg *Registration) BeforeCreate(tx *gorm.DB) (err error) {
 	reg.ID = uuid.New()
 	return
 }
 
+func (s *AttendanceSession) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New()
+	return
+}
+
 func (a *Activity) BeforeCreate(tx *gorm.DB) (err error) {
 	a.ID = uuid.New()
 	return
@@ -136,5 +228,9 @@ func (a *Activity) BeforeCreate(tx *gorm.DB) (err error) {
 
 func (ar *ActivityRegistration) BeforeCreate(tx *gorm.DB) (err error) {
 	ar.ID = uuid.New()
+	if ar.QRCodeToken == nil {
+		token := uuid.New().String()
+		ar.QRCodeToken = &token
+	}
 	return
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength  = 100
+	maxBioLength   = 500
+	maxImageURLLen = 2048
+)
+
+// optionalString tells an absent JSON field (Set is false) apart from an
+// explicit null (Set with a nil Value).
+type optionalString struct {
+	Set   bool
+	Value *string
+}
+
+func (o *optionalString) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// validImageURL accepts absolute http(s) URLs and server-relative paths.
+func validImageURL(s string) bool {
+	if len(s) > maxImageURLLen {
+		return false
+	}
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// handleProfileUpdate applies a partial update to the caller's profile. Only
+// fields present in the body change, including individual privacy settings;
+// null or "" clears bio and profile_image. Group membership goes through
+// /api/groups/{id}/join.
+func (s *Server) handleProfileUpdate(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	var input struct {
+		Name         optionalString `json:"name"`
+		Bio          optionalString `json:"bio"`
+		ProfileImage optionalString `json:"profile_image"`
+		Privacy      *privacyInput  `json:"privacy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var changes UserChanges
+	if input.Name.Set {
+		if input.Name.Value == nil {
+			http.Error(w, "name cannot be cleared", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimSpace(*input.Name.Value)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			http.Error(w, "name must be 1-100 characters", http.StatusBadRequest)
+			return
+		}
+		changes.Name = &name
+	}
+	if input.Bio.Set {
+		bio := ""
+		if input.Bio.Value != nil {
+			bio = strings.TrimSpace(*input.Bio.Value)
+		}
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			http.Error(w, "bio must be at most 500 characters", http.StatusBadRequest)
+			return
+		}
+		changes.Bio = &bio
+	}
+	if input.ProfileImage.Set {
+		image := ""
+		if input.ProfileImage.Value != nil {
+			image = strings.TrimSpace(*input.ProfileImage.Value)
+		}
+		if image != "" && !validImageURL(image) {
+			http.Error(w, "profile_image must be an http(s) URL", http.StatusBadRequest)
+			return
+		}
+		changes.ProfileImage = &image
+	}
+
+	user, err := s.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if input.Privacy != nil {
+		applyPrivacyUpdate(&user.Privacy, input.Privacy)
+		changes.Privacy = &user.Privacy
+	}
+	if err := s.Users.Update(userID, changes); err != nil {
+		http.Error(w, "Update failed", http.StatusInternalServerError)
+		return
+	}
+
+	user, _ = s.Users.GetProfile(userID)
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 1024
+	// qrLinkTTL is how long a signed QR link, e.g. one embedded in a
+	// confirmation email, keeps working.
+	qrLinkTTL = 30 * 24 * time.Hour
+)
+
+// handleRegistrationQR renders the check-in code of a registration as a PNG or
+// SVG image, depending on the requested extension. Only the registration's
+// owner and admins may fetch it, unless the URL carries a signature from
+// handleRegistrationQRLink.
+func (s *Server) handleRegistrationQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid registration ID", http.StatusBadRequest)
+		return
+	}
+	signed := s.validQRLink(r, "events", regID)
+	userID := s.getUserIDFromToken(r)
+	if !signed && userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reg, err := s.Registrations.Get(regID)
+	if err != nil {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+	if !signed && reg.UserID != userID && s.getRoleFromToken(r) != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if reg.Status == "cancelled" {
+		http.Error(w, "Registration is cancelled", http.StatusGone)
+		return
+	}
+
+	writeQR(w, r, reg.QRCodeToken)
+}
+
+// handleActivityRegistrationQR is handleRegistrationQR for activity registrations.
+func (s *Server) handleActivityRegistrationQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid registration ID", http.StatusBadRequest)
+		return
+	}
+	signed := s.validQRLink(r, "activities", regID)
+	userID := s.getUserIDFromToken(r)
+	if !signed && userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reg, err := s.Registrations.GetActivity(regID)
+	if err != nil {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+	if !signed && reg.UserID != userID && s.getRoleFromToken(r) != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if reg.Status == "cancelled" || reg.QRCodeToken == nil {
+		http.Error(w, "Registration is cancelled", http.StatusGone)
+		return
+	}
+
+	writeQR(w, r, *reg.QRCodeToken)
+}
+
+// handleRegistrationQRLink returns signed, expiring URLs of a registration's
+// QR images that work without an Authorization header, for <img> tags in
+// emails. Only the registration's owner and admins may ask for them.
+func (s *Server) handleRegistrationQRLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid registration ID", http.StatusBadRequest)
+		return
+	}
+	reg, err := s.Registrations.Get(regID)
+	if err != nil {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+	if reg.UserID != s.getUserIDFromToken(r) && s.getRoleFromToken(r) != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.writeQRLink(w, "events", regID)
+}
+
+// handleActivityRegistrationQRLink is handleRegistrationQRLink for activity
+// registrations.
+func (s *Server) handleActivityRegistrationQRLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid registration ID", http.StatusBadRequest)
+		return
+	}
+	reg, err := s.Registrations.GetActivity(regID)
+	if err != nil {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+	if reg.UserID != s.getUserIDFromToken(r) && s.getRoleFromToken(r) != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.writeQRLink(w, "activities", regID)
+}
+
+// writeQRLink sends the signed QR image URLs of a registration; kind is
+// "events" or "activities", as in the image paths.
+func (s *Server) writeQRLink(w http.ResponseWriter, kind string, regID uuid.UUID) {
+	expires := time.Now().Add(qrLinkTTL).Truncate(time.Second)
+	query := fmt.Sprintf("?expires=%d&sig=%s", expires.Unix(), s.qrSignature(kind, regID, expires.Unix()))
+	base := "/api/" + kind + "/registrations/" + regID.String()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"png":        base + "/qr.png" + query,
+		"svg":        base + "/qr.svg" + query,
+		"expires_at": expires,
+	})
+}
+
+// qrSignature signs a QR link to a registration of kind until expires, a
+// Unix time. It is an HMAC rather than a JWT so that it can never pass for
+// a login token.
+func (s *Server) qrSignature(kind string, regID uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.JWTSecret))
+	fmt.Fprintf(mac, "qr-link\n%s\n%s\n%d", kind, regID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validQRLink reports whether r carries an unexpired qrSignature for the
+// registration.
+func (s *Server) validQRLink(r *http.Request, kind string, regID uuid.UUID) bool {
+	query := r.URL.Query()
+	sig := query.Get("sig")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if sig == "" || err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.qrSignature(kind, regID, expires)))
+}
+
+// writeQR renders token as a PNG, or as SVG when the path ends in .svg.
+func writeQR(w http.ResponseWriter, r *http.Request, token string) {
+	code, err := qrcode.New(token, qrcode.Medium)
+	if err != nil {
+		http.Error(w, "Could not generate QR code", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is a bearer credential at the door, so keep it out of shared caches.
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if strings.HasSuffix(r.URL.Path, ".svg") {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(qrSVG(code.Bitmap())))
+		return
+	}
+
+	size := defaultQRSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxQRSize {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	png, err := code.PNG(size)
+	if err != nil {
+		http.Error(w, "Could not generate QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// qrSVG draws a QR bitmap (quiet zone included) as one SVG path with a unit
+// square per dark module, so it scales cleanly for printed badges.
+func qrSVG(bitmap [][]bool) string {
+	n := len(bitmap)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// get fetches path as raw bytes, for responses that are not JSON.
+func (ts *testServer) get(path, token string) (*http.Response, []byte) {
+	ts.t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+// checkQR fails the test unless path serves a QR image of the type its
+// extension asks for.
+func (ts *testServer) checkQR(path, token string) {
+	ts.t.Helper()
+	resp, body := ts.get(path, token)
+	if resp.StatusCode != http.StatusOK {
+		ts.t.Fatalf("GET %s: status %d: %s", path, resp.StatusCode, body)
+	}
+	wantType, magic := "image/png", []byte("\x89PNG\r\n\x1a\n")
+	if strings.Contains(path, ".svg") {
+		wantType, magic = "image/svg+xml", []byte("<svg ")
+	}
+	if got := resp.Header.Get("Content-Type"); got != wantType || !bytes.HasPrefix(body, magic) {
+		ts.t.Errorf("GET %s: %s starting %q", path, got, body[:min(len(body), 8)])
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+		ts.t.Errorf("GET %s: Cache-Control %q", path, cc)
+	}
+}
+
+func TestRegistrationQR(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{
+			"title": "Hackathon", "event_date": time.Now().Add(48 * time.Hour),
+		}, &event)
+		var reg Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", alice.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+		base := "/api/events/registrations/" + reg.ID.String()
+
+		for _, ext := range []string{"/qr.png", "/qr.svg"} {
+			ts.checkQR(base+ext, alice.Token)
+			ts.checkQR(base+ext, admin.Token)
+			if resp, _ := ts.get(base+ext, bob.Token); resp.StatusCode != http.StatusForbidden {
+				t.Errorf("other user %s: status %d", ext, resp.StatusCode)
+			}
+			if resp, _ := ts.get(base+ext, ""); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("anonymous %s: status %d", ext, resp.StatusCode)
+			}
+		}
+		ts.checkQR(base+"/qr.png?size=64", alice.Token)
+		if resp, _ := ts.get(base+"/qr.png?size=5000", alice.Token); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("oversized QR: status %d", resp.StatusCode)
+		}
+		if resp, _ := ts.get("/api/events/registrations/"+uuid.NewString()+"/qr.png", admin.Token); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("unknown registration: status %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestRegistrationQRLink(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+
+		var event Event
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{
+			"title": "Hackathon", "event_date": time.Now().Add(48 * time.Hour),
+		}, &event)
+		var reg, other Registration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", alice.Token, map[string]interface{}{"event_id": event.ID}, &reg)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events/register", bob.Token, map[string]interface{}{"event_id": event.ID}, &other)
+		linkPath := "/api/events/registrations/" + reg.ID.String() + "/qr-link"
+
+		var link struct {
+			PNG       string    `json:"png"`
+			SVG       string    `json:"svg"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		ts.mustDo(http.StatusForbidden, http.MethodGet, linkPath, bob.Token, nil, nil)
+		ts.mustDo(http.StatusUnauthorized, http.MethodGet, linkPath, "", nil, nil)
+		ts.mustDo(http.StatusOK, http.MethodGet, linkPath, admin.Token, nil, &link)
+		ts.mustDo(http.StatusOK, http.MethodGet, linkPath, alice.Token, nil, &link)
+		if time.Until(link.ExpiresAt) < qrLinkTTL-time.Minute {
+			t.Errorf("link expires at %v", link.ExpiresAt)
+		}
+
+		// The links work in an <img>, without an Authorization header.
+		ts.checkQR(link.PNG, "")
+		ts.checkQR(link.SVG, "")
+		ts.checkQR(link.PNG+"&size=64", "")
+
+		for name, path := range map[string]string{
+			"tampered signature":  link.PNG[:len(link.PNG)-2] + "xx",
+			"extended expiry":     strings.Replace(link.PNG, "expires=", "expires=9", 1),
+			"other registration":  strings.Replace(link.PNG, reg.ID.String(), other.ID.String(), 1),
+			"activity path":       strings.Replace(link.PNG, "/api/events/", "/api/activities/", 1),
+			"signature only":      link.PNG[:strings.Index(link.PNG, "?")] + "?sig=" + link.PNG[strings.Index(link.PNG, "sig=")+4:],
+			"no query parameters": link.PNG[:strings.Index(link.PNG, "?")],
+		} {
+			if resp, _ := ts.get(path, ""); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s: status %d", name, resp.StatusCode)
+			}
+		}
+	})
+}
+
+func TestActivityRegistrationQRLink(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+
+		start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+		var activity Activity
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities", admin.Token, map[string]interface{}{
+			"title": "Workshop", "start_time": start, "end_time": start.Add(time.Hour),
+		}, &activity)
+		var reg ActivityRegistration
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities/register", alice.Token, map[string]interface{}{"activity_id": activity.ID}, &reg)
+		base := "/api/activities/registrations/" + reg.ID.String()
+
+		ts.checkQR(base+"/qr.svg", alice.Token)
+		ts.checkQR(base+"/qr.png", admin.Token)
+		if resp, _ := ts.get(base+"/qr.png", bob.Token); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("other user: status %d", resp.StatusCode)
+		}
+
+		var link struct{ PNG, SVG string }
+		ts.mustDo(http.StatusForbidden, http.MethodGet, base+"/qr-link", bob.Token, nil, nil)
+		ts.mustDo(http.StatusOK, http.MethodGet, base+"/qr-link", alice.Token, nil, &link)
+		ts.checkQR(link.PNG, "")
+		ts.checkQR(link.SVG, "")
+		if resp, _ := ts.get(strings.Replace(link.PNG, "/api/activities/", "/api/events/", 1), ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("event path: status %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestQRLinkExpires(t *testing.T) {
+	config := defaultConfig()
+	config.JWTSecret = "integration-test-secret"
+	s := newServer(config, newMemoryStores(), newHub(), nil)
+	regID := uuid.New()
+
+	for name, tc := range map[string]struct {
+		expires time.Time
+		valid   bool
+	}{
+		"future": {time.Now().Add(time.Hour), true},
+		"past":   {time.Now().Add(-time.Second), false},
+	} {
+		exp := tc.expires.Unix()
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/qr.png?expires=%d&sig=%s", exp, s.qrSignature("events", regID, exp)), nil)
+		if got := s.validQRLink(r, "events", regID); got != tc.valid {
+			t.Errorf("%s: valid %v", name, got)
+		}
+	}
+
+	// A link signed under another secret is worthless.
+	other := newServer(Config{JWTSecret: "some-other-secret-value"}, newMemoryStores(), newHub(), nil)
+	exp := time.Now().Add(time.Hour).Unix()
+	r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/qr.png?expires=%d&sig=%s", exp, other.qrSignature("events", regID, exp)), nil)
+	if s.validQRLink(r, "events", regID) {
+		t.Error("accepted a signature made with another secret")
+	}
+}
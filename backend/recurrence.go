@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound on generated occurrences, so a typo can't create thousands of rows.
+const maxOccurrences = 100
+
+// errInvalidRecurrence marks rules that are well-formed but produce no
+// usable series from the given start.
+var errInvalidRecurrence = errors.New("invalid recurrence")
+
+// RecurrenceRule is the subset of RFC 5545 RRULE we support: daily or weekly
+// repetition every Interval periods, ending after Count occurrences or on
+// Until, whichever comes first.
+type RecurrenceRule struct {
+	Freq     string     `json:"freq"` // 'daily', 'weekly' or 'biweekly' (weekly, interval 2)
+	Interval int        `json:"interval"`
+	Count    int        `json:"count"`
+	Until    *time.Time `json:"until"`
+}
+
+// parseRRule parses strings such as "FREQ=WEEKLY;INTERVAL=2;COUNT=8".
+func parseRRule(s string) (RecurrenceRule, error) {
+	var rule RecurrenceRule
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue // e.g. a trailing ";"
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return rule, fmt.Errorf("malformed RRULE part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToLower(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return rule, errors.New("INTERVAL must be an integer")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return rule, errors.New("COUNT must be an integer")
+			}
+			rule.Count = n
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", value)
+			if err != nil {
+				t, err = time.Parse(time.RFC3339, value)
+			}
+			if err != nil {
+				return rule, errors.New("UNTIL must be a UTC date-time")
+			}
+			rule.Until = &t
+		default:
+			return rule, fmt.Errorf("unsupported RRULE part %s", key)
+		}
+	}
+	return rule, rule.normalize()
+}
+
+// normalize validates the rule and resolves the biweekly alias.
+func (r *RecurrenceRule) normalize() error {
+	if r.Freq == "biweekly" {
+		r.Freq = "weekly"
+		if r.Interval == 0 {
+			r.Interval = 2
+		}
+	}
+	if r.Freq != "daily" && r.Freq != "weekly" {
+		return errors.New("freq must be daily, weekly or biweekly")
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 0 {
+		return errors.New("interval must be positive")
+	}
+	if r.Count < 0 || r.Count > maxOccurrences {
+		return fmt.Errorf("count must be between 1 and %d", maxOccurrences)
+	}
+	if r.Count == 0 && r.Until == nil {
+		return errors.New("either count or until is required")
+	}
+	return nil
+}
+
+// String renders the rule as an RRULE value.
+func (r RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + strings.ToUpper(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences lists the start times produced by the rule, beginning with
+// start itself. Stepping by calendar days keeps the wall-clock time stable
+// across DST changes. Rules that end before start, or whose Until allows more
+// than maxOccurrences, are rejected rather than cut short.
+func (r RecurrenceRule) Occurrences(start time.Time) ([]time.Time, error) {
+	if r.Until != nil && r.Until.Before(start) {
+		return nil, fmt.Errorf("%w: until is before the first occurrence", errInvalidRecurrence)
+	}
+	step := r.Interval
+	if r.Freq == "weekly" {
+		step *= 7
+	}
+
+	var out []time.Time
+	for i := 0; ; i++ {
+		t := start.AddDate(0, 0, i*step)
+		if r.Until != nil && t.After(*r.Until) {
+			break
+		}
+		if r.Count > 0 && len(out) >= r.Count {
+			break
+		}
+		if len(out) == maxOccurrences {
+			return nil, fmt.Errorf("%w: more than %d occurrences before until; set a count or an earlier until", errInvalidRecurrence, maxOccurrences)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
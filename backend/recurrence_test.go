@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	until := time.Date(2026, 12, 31, 18, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		in   string
+		want RecurrenceRule
+		err  bool
+	}{
+		{in: "FREQ=DAILY;COUNT=5", want: RecurrenceRule{Freq: "daily", Interval: 1, Count: 5}},
+		{in: "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=8", want: RecurrenceRule{Freq: "weekly", Interval: 2, Count: 8}},
+		{in: "freq=weekly;count=3;", want: RecurrenceRule{Freq: "weekly", Interval: 1, Count: 3}},
+		{in: " FREQ=BIWEEKLY;UNTIL=20261231T183000Z ", want: RecurrenceRule{Freq: "weekly", Interval: 2, Until: &until}},
+		{in: "FREQ=DAILY;UNTIL=2026-12-31T18:30:00Z", want: RecurrenceRule{Freq: "daily", Interval: 1, Until: &until}},
+		{in: "FREQ=MONTHLY;COUNT=3", err: true},
+		{in: "FREQ=DAILY", err: true},
+		{in: "FREQ=DAILY;COUNT=101", err: true},
+		{in: "FREQ=DAILY;COUNT=-1", err: true},
+		{in: "FREQ=DAILY;INTERVAL=-2;COUNT=3", err: true},
+		{in: "FREQ=DAILY;INTERVAL=x;COUNT=3", err: true},
+		{in: "FREQ=DAILY;UNTIL=tomorrow", err: true},
+		{in: "FREQ=DAILY;BYDAY=MO;COUNT=3", err: true},
+		{in: "FREQ=DAILY;COUNT", err: true},
+		{in: "", err: true},
+	} {
+		got, err := parseRRule(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseRRule(%q) = %+v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRRule(%q): %v", tc.in, err)
+			continue
+		}
+		if got.Freq != tc.want.Freq || got.Interval != tc.want.Interval || got.Count != tc.want.Count ||
+			(got.Until == nil) != (tc.want.Until == nil) || (got.Until != nil && !got.Until.Equal(*tc.want.Until)) {
+			t.Errorf("parseRRule(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+		if again, err := parseRRule(got.String()); err != nil || again.String() != got.String() {
+			t.Errorf("%q does not round-trip: %q, %v", got.String(), again.String(), err)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	until := func(t time.Time) *time.Time { return &t }
+
+	for _, tc := range []struct {
+		name  string
+		rule  RecurrenceRule
+		count int
+		last  time.Time
+		err   bool
+	}{
+		{"daily count", RecurrenceRule{Freq: "daily", Interval: 1, Count: 3}, 3, start.Add(2 * day), false},
+		{"weekly interval", RecurrenceRule{Freq: "weekly", Interval: 2, Count: 4}, 4, start.Add(6 * 7 * day), false},
+		{"until is inclusive", RecurrenceRule{Freq: "weekly", Interval: 1, Until: until(start.Add(14 * day))}, 3, start.Add(14 * day), false},
+		{"count before until", RecurrenceRule{Freq: "daily", Interval: 1, Count: 2, Until: until(start.Add(10 * day))}, 2, start.Add(day), false},
+		{"until before count", RecurrenceRule{Freq: "daily", Interval: 1, Count: 10, Until: until(start.Add(36 * time.Hour))}, 2, start.Add(day), false},
+		{"until on start", RecurrenceRule{Freq: "daily", Interval: 1, Until: until(start)}, 1, start, false},
+		{"until at the cap", RecurrenceRule{Freq: "daily", Interval: 1, Until: until(start.Add((maxOccurrences - 1) * day))}, maxOccurrences, start.Add((maxOccurrences - 1) * day), false},
+		{"until past the cap", RecurrenceRule{Freq: "daily", Interval: 1, Until: until(start.Add(maxOccurrences * day))}, 0, time.Time{}, true},
+		{"until before start", RecurrenceRule{Freq: "daily", Interval: 1, Until: until(start.Add(-day))}, 0, time.Time{}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.rule.Occurrences(start)
+			if tc.err {
+				if !errors.Is(err, errInvalidRecurrence) {
+					t.Fatalf("got %d occurrences, %v; want errInvalidRecurrence", len(got), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tc.count || !got[0].Equal(start) || !got[len(got)-1].Equal(tc.last) {
+				t.Errorf("%d occurrences from %v to %v, want %d ending %v", len(got), got[0], got[len(got)-1], tc.count, tc.last)
+			}
+		})
+	}
+}
+
+// TestOccurrencesKeepWallClockAcrossDST steps over the end of US daylight
+// saving time: the meeting stays at 10:00 local time.
+func TestOccurrencesKeepWallClockAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := RecurrenceRule{Freq: "weekly", Interval: 1, Count: 3}
+	got, err := rule.Occurrences(time.Date(2026, 10, 26, 10, 0, 0, 0, ny))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, occ := range got {
+		if occ.Hour() != 10 {
+			t.Errorf("occurrence at %v, want 10:00 local", occ)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Events and activities linked to groups through event_groups and
+// activity_groups are members-only: a user needs a membership in any one of
+// the linked groups. Activities also inherit their parent event's restriction.
+
+var errUnknownGroup = errors.New("unknown group in group_ids")
+
+const eventVisibleSQL = `(NOT EXISTS (SELECT 1 FROM event_groups WHERE event_groups.event_id = events.id)
+	OR EXISTS (SELECT 1 FROM event_groups JOIN group_memberships ON group_memberships.group_id = event_groups.group_id
+		WHERE event_groups.event_id = events.id AND group_memberships.user_id = ?))`
+
+const activityVisibleSQL = `(NOT EXISTS (SELECT 1 FROM activity_groups WHERE activity_groups.activity_id = activities.id)
+	OR EXISTS (SELECT 1 FROM activity_groups JOIN group_memberships ON group_memberships.group_id = activity_groups.group_id
+		WHERE activity_groups.activity_id = activities.id AND group_memberships.user_id = ?))
+	AND (activities.event_id IS NULL
+	OR NOT EXISTS (SELECT 1 FROM event_groups WHERE event_groups.event_id = activities.event_id)
+	OR EXISTS (SELECT 1 FROM event_groups JOIN group_memberships ON group_memberships.group_id = event_groups.group_id
+		WHERE event_groups.event_id = activities.event_id AND group_memberships.user_id = ?))`
+
+// visibleEvents limits an events query to what v may see. Admins see
+// everything; anonymous viewers only unrestricted events.
+func visibleEvents(v Viewer) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if v.Admin {
+			return db
+		}
+		return db.Where(eventVisibleSQL, v.UserID)
+	}
+}
+
+// visibleActivities is visibleEvents for activities queries.
+func visibleActivities(v Viewer) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if v.Admin {
+			return db
+		}
+		return db.Where(activityVisibleSQL, v.UserID, v.UserID)
+	}
+}
+
+// validateGroupIDs checks that every id names an existing group.
+func validateGroupIDs(groups GroupStore, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	count, err := groups.CountExisting(uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+	if count != int64(len(uniqueIDs(ids))) {
+		return errUnknownGroup
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func replaceGroupLinks(tx *gorm.DB, table, column string, ownerIDs, groupIDs []uuid.UUID) error {
+	if len(ownerIDs) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM "+table+" WHERE "+column+" IN ?", ownerIDs).Error; err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	for _, ownerID := range ownerIDs {
+		for _, groupID := range uniqueIDs(groupIDs) {
+			rows = append(rows, map[string]interface{}{column: ownerID, "group_id": groupID})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Table(table).Create(&rows).Error
+}
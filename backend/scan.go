@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// scanError is a check-in failure that maps directly to an HTTP response.
+type scanError struct {
+	Status  int
+	Message string
+}
+
+func (e *scanError) Error() string { return e.Message }
+
+var (
+	errInvalidScanToken = &scanError{http.StatusNotFound, "Invalid token"}
+	errScanCancelled    = &scanError{http.StatusConflict, "Registration is cancelled"}
+	errScanDuplicate    = &scanError{http.StatusConflict, "Already checked in"}
+)
+
+func writeScanError(w http.ResponseWriter, err error) {
+	var se *scanError
+	if errors.As(err, &se) {
+		http.Error(w, se.Message, se.Status)
+		return
+	}
+	http.Error(w, "Check-in failed", http.StatusInternalServerError)
+}
+
+// scanEventToken checks in the event registration holding token. With toggle,
+// scanning a ticket that is already inside checks it out instead. The
+// registration stays locked from the status check to the write, so two
+// scanners reading the same ticket at once cannot both act on it.
+func (s *Server) scanEventToken(token string, toggle bool) (Registration, error) {
+	var reg Registration
+	action := "checked_in"
+	err := s.Transaction(func(tx Stores) error {
+		var err error
+		reg, err = tx.Registrations.GetByTokenForUpdate(token)
+		if err != nil {
+			return errInvalidScanToken
+		}
+
+		if reg.Status == "cancelled" {
+			return errScanCancelled
+		}
+
+		now := time.Now()
+		if reg.Status == "checked_in" {
+			if !toggle {
+				return errScanDuplicate
+			}
+			action = "checked_out"
+			return checkOutRegistration(tx.Registrations, &reg, now)
+		}
+		return tx.Registrations.CheckIn(&reg, now)
+	})
+	if err != nil {
+		return reg, err
+	}
+	s.publishRegistration(reg, action)
+	return reg, nil
+}
+
+// scanActivityToken marks attendance for the activity registration holding
+// token, locking it like scanEventToken does.
+func (s *Server) scanActivityToken(token string) (ActivityRegistration, error) {
+	var reg ActivityRegistration
+	err := s.Transaction(func(tx Stores) error {
+		var err error
+		reg, err = tx.Registrations.GetActivityByTokenForUpdate(token)
+		if err != nil {
+			return errInvalidScanToken
+		}
+
+		switch reg.Status {
+		case "cancelled":
+			return errScanCancelled
+		case "checked_in":
+			return errScanDuplicate
+		}
+
+		return tx.Registrations.CheckInActivity(&reg, time.Now())
+	})
+	return reg, err
+}
+
+// backfillActivityCheckInTokens issues check-in tokens to activity
+// registrations created before activities had check-in.
+func backfillActivityCheckInTokens(db *gorm.DB) error {
+	var regs []ActivityRegistration
+	if err := db.Where("qr_code_token IS NULL").Find(&regs).Error; err != nil {
+		return fmt.Errorf("reading activity registrations without a check-in token: %w", err)
+	}
+	for _, reg := range regs {
+		if err := db.Model(&reg).Update("qr_code_token", uuid.New().String()).Error; err != nil {
+			return fmt.Errorf("issuing a check-in token to activity registration %s: %w", reg.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleActivityCheckIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		QRCodeToken string `json:"qr_code_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	reg, err := s.scanActivityToken(input.QRCodeToken)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reg)
+}
+
+// handleScan is the door scanner's single endpoint: it works out whether the
+// token belongs to an event or an activity registration and checks it in.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		QRCodeToken string `json:"qr_code_token"`
+		Toggle      bool   `json:"toggle"` // Applies to event tickets only
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var kind string
+	var result interface{}
+	reg, err := s.scanEventToken(input.QRCodeToken, input.Toggle)
+	if err == errInvalidScanToken {
+		kind = "activity"
+		result, err = s.scanActivityToken(input.QRCodeToken)
+	} else {
+		kind, result = "event", reg
+	}
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":         kind,
+		"registration": result,
+	})
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errNotInSeries          = errors.New("not part of a series")
+	errActivityOutsideEvent = errors.New("invalid activity schedule")
+)
+
+// recurrenceFromInput accepts either a structured rule or an RRULE string.
+// It returns nil when neither is given.
+func recurrenceFromInput(rule *RecurrenceRule, rrule string) (*RecurrenceRule, error) {
+	if rrule != "" {
+		parsed, err := parseRRule(rrule)
+		if err != nil {
+			return nil, err
+		}
+		return &parsed, nil
+	}
+	if rule == nil {
+		return nil, nil
+	}
+	if err := rule.normalize(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// createEventSeries stores one Event per occurrence of rule, each a copy of
+// template starting at the occurrence's date. Run it inside a transaction.
+func createEventSeries(tx Stores, template Event, rule RecurrenceRule) (Series, []Event, error) {
+	series := Series{Kind: "event", RRule: rule.String()}
+	if err := tx.Events.CreateSeries(&series); err != nil {
+		return series, nil, err
+	}
+	starts, err := rule.Occurrences(template.EventDate)
+	if err != nil {
+		return series, nil, err
+	}
+	var events []Event
+	for _, start := range starts {
+		event := template
+		event.EventDate = start
+		event.SeriesID = &series.ID
+		if err := tx.Events.Create(&event); err != nil {
+			return series, nil, err
+		}
+		events = append(events, event)
+	}
+	return series, events, nil
+}
+
+// createActivitySeries is createEventSeries for activities; every occurrence
+// keeps the template's duration.
+func createActivitySeries(tx Stores, loc *time.Location, template Activity, rule RecurrenceRule) (Series, []Activity, error) {
+	series := Series{Kind: "activity", RRule: rule.String()}
+	if err := tx.Activities.CreateSeries(&series); err != nil {
+		return series, nil, err
+	}
+	duration := template.EndTime.Sub(template.StartTime)
+	starts, err := rule.Occurrences(template.StartTime)
+	if err != nil {
+		return series, nil, err
+	}
+	var activities []Activity
+	for _, start := range starts {
+		activity := template
+		activity.StartTime = start
+		activity.EndTime = start.Add(duration)
+		activity.SeriesID = &series.ID
+		if err := validateActivitySchedule(tx.Events, loc, activity); err != nil {
+			return series, nil, fmt.Errorf("%w: occurrence on %s: %v", errActivityOutsideEvent, start.Format("2006-01-02"), err)
+		}
+		if err := tx.Activities.Create(&activity); err != nil {
+			return series, nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return series, activities, nil
+}
+
+// editScope reads ?scope=: 'occurrence' (default) edits only the addressed
+// record, 'series' applies the change to it and every later occurrence of
+// its series. Earlier occurrences may be over already, so they are left as
+// they were.
+func editScope(r *http.Request) (string, bool) {
+	switch scope := r.URL.Query().Get("scope"); scope {
+	case "", "occurrence":
+		return "occurrence", true
+	case "series":
+		return scope, true
+	}
+	return "", false
+}
+
+// handleEventUpdate serves PUT /api/events?event_id=&scope=. Only fields
+// present in the body change. A new event_date on a series edit moves the
+// event and every later occurrence by the same offset.
+func (s *Server) handleEventUpdate(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(r.URL.Query().Get("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	scope, ok := editScope(r)
+	if !ok {
+		http.Error(w, "scope must be 'occurrence' or 'series'", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Title       *string      `json:"title"`
+		Description *string      `json:"description"`
+		Category    *string      `json:"category"`
+		ImageUrl    *string      `json:"image_url"`
+		Location    *string      `json:"location"`
+		Capacity    *int         `json:"capacity"`
+		EventDate   *time.Time   `json:"event_date"`
+		GroupIDs    *[]uuid.UUID `json:"group_ids"` // An empty list lifts the restriction
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	event, err := s.Events.Get(eventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if scope == "series" && event.SeriesID == nil {
+		http.Error(w, "Event is not part of a series", http.StatusBadRequest)
+		return
+	}
+	if input.GroupIDs != nil {
+		if err := validateGroupIDs(s.Groups, *input.GroupIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes := EventChanges{
+		Title:       input.Title,
+		Description: input.Description,
+		Category:    input.Category,
+		ImageUrl:    input.ImageUrl,
+		Location:    input.Location,
+		Capacity:    input.Capacity,
+	}
+
+	err = s.Transaction(func(tx Stores) error {
+		if scope == "occurrence" {
+			if input.GroupIDs != nil {
+				if err := tx.Events.SetGroups([]uuid.UUID{event.ID}, *input.GroupIDs); err != nil {
+					return err
+				}
+			}
+			if input.EventDate != nil {
+				changes.EventDate = input.EventDate
+				if err := shiftEventAgenda(tx, event.ID, input.EventDate.Sub(event.EventDate)); err != nil {
+					return err
+				}
+			}
+			return tx.Events.Update([]uuid.UUID{event.ID}, changes)
+		}
+
+		series, err := tx.Events.ListSeries(adminViewer, *event.SeriesID)
+		if err != nil {
+			return err
+		}
+		var occurrences []Event
+		var ids []uuid.UUID
+		for _, occ := range series {
+			if !occ.EventDate.Before(event.EventDate) {
+				occurrences = append(occurrences, occ)
+				ids = append(ids, occ.ID)
+			}
+		}
+		if input.GroupIDs != nil {
+			if err := tx.Events.SetGroups(ids, *input.GroupIDs); err != nil {
+				return err
+			}
+		}
+		if err := tx.Events.Update(ids, changes); err != nil {
+			return err
+		}
+		if input.EventDate != nil {
+			shift := input.EventDate.Sub(event.EventDate)
+			for _, occ := range occurrences {
+				date := occ.EventDate.Add(shift)
+				if err := tx.Events.Update([]uuid.UUID{occ.ID}, EventChanges{EventDate: &date}); err != nil {
+					return err
+				}
+				if err := shiftEventAgenda(tx, occ.ID, shift); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Update failed", http.StatusInternalServerError)
+		return
+	}
+
+	var events []Event
+	if scope == "series" {
+		events, _ = s.Events.ListSeries(adminViewer, *event.SeriesID)
+	} else if updated, err := s.Events.GetWithGroups(event.ID); err == nil {
+		events = []Event{updated}
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+// shiftEventAgenda moves the activities of a rescheduled event along with it,
+// keeping them on the event's day.
+func shiftEventAgenda(tx Stores, eventID uuid.UUID, shift time.Duration) error {
+	if shift == 0 {
+		return nil
+	}
+	agenda, err := tx.Activities.List(adminViewer, &eventID)
+	if err != nil {
+		return err
+	}
+	for _, a := range agenda {
+		start, end := a.StartTime.Add(shift), a.EndTime.Add(shift)
+		if err := tx.Activities.Update([]uuid.UUID{a.ID}, ActivityChanges{StartTime: &start, EndTime: &end}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleActivityUpdate serves PUT /api/activities?activity_id=&scope=, with
+// the same semantics as handleEventUpdate.
+func (s *Server) handleActivityUpdate(w http.ResponseWriter, r *http.Request) {
+	activityID, err := uuid.Parse(r.URL.Query().Get("activity_id"))
+	if err != nil {
+		http.Error(w, "Invalid activity ID", http.StatusBadRequest)
+		return
+	}
+	scope, ok := editScope(r)
+	if !ok {
+		http.Error(w, "scope must be 'occurrence' or 'series'", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Title       *string      `json:"title"`
+		Description *string      `json:"description"`
+		ImageUrl    *string      `json:"image_url"`
+		Location    *string      `json:"location"`
+		Capacity    *int         `json:"capacity"`
+		StartTime   *time.Time   `json:"start_time"`
+		EndTime     *time.Time   `json:"end_time"`
+		GroupIDs    *[]uuid.UUID `json:"group_ids"` // An empty list lifts the restriction
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	activity, err := s.Activities.Get(activityID)
+	if err != nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	if scope == "series" && activity.SeriesID == nil {
+		http.Error(w, "Activity is not part of a series", http.StatusBadRequest)
+		return
+	}
+	if input.GroupIDs != nil {
+		if err := validateGroupIDs(s.Groups, *input.GroupIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	start, end := activity.StartTime, activity.EndTime
+	if input.StartTime != nil {
+		start = *input.StartTime
+	}
+	if input.EndTime != nil {
+		end = *input.EndTime
+	}
+	if scope == "occurrence" || activity.EventID == nil {
+		moved := activity
+		moved.StartTime, moved.EndTime = start, end
+		if err := validateActivitySchedule(s.Events, s.config.Location, moved); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes := ActivityChanges{
+		Title:       input.Title,
+		Description: input.Description,
+		ImageUrl:    input.ImageUrl,
+		Location:    input.Location,
+		Capacity:    input.Capacity,
+	}
+
+	err = s.Transaction(func(tx Stores) error {
+		if scope == "occurrence" {
+			if input.GroupIDs != nil {
+				if err := tx.Activities.SetGroups([]uuid.UUID{activity.ID}, *input.GroupIDs); err != nil {
+					return err
+				}
+			}
+			changes.StartTime, changes.EndTime = &start, &end
+			return tx.Activities.Update([]uuid.UUID{activity.ID}, changes)
+		}
+
+		series, err := tx.Activities.ListSeries(adminViewer, *activity.SeriesID)
+		if err != nil {
+			return err
+		}
+		var occurrences []Activity
+		var ids []uuid.UUID
+		for _, occ := range series {
+			if !occ.StartTime.Before(activity.StartTime) {
+				occurrences = append(occurrences, occ)
+				ids = append(ids, occ.ID)
+			}
+		}
+		if input.GroupIDs != nil {
+			if err := tx.Activities.SetGroups(ids, *input.GroupIDs); err != nil {
+				return err
+			}
+		}
+		if err := tx.Activities.Update(ids, changes); err != nil {
+			return err
+		}
+		startShift, endShift := start.Sub(activity.StartTime), end.Sub(activity.EndTime)
+		if startShift != 0 || endShift != 0 {
+			for _, occ := range occurrences {
+				moved := occ
+				moved.StartTime, moved.EndTime = occ.StartTime.Add(startShift), occ.EndTime.Add(endShift)
+				if err := validateActivitySchedule(tx.Events, s.config.Location, moved); err != nil {
+					return fmt.Errorf("%w: occurrence on %s: %v", errActivityOutsideEvent, occ.StartTime.Format("2006-01-02"), err)
+				}
+				if err := tx.Activities.Update([]uuid.UUID{occ.ID}, ActivityChanges{StartTime: &moved.StartTime, EndTime: &moved.EndTime}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errActivityOutsideEvent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Update failed", http.StatusInternalServerError)
+		return
+	}
+
+	var activities []Activity
+	if scope == "series" {
+		activities, _ = s.Activities.ListSeries(adminViewer, *activity.SeriesID)
+	} else if updated, err := s.Activities.GetWithGroups(activity.ID); err == nil {
+		activities = []Activity{updated}
+	}
+	json.NewEncoder(w).Encode(activities)
+}
+
+// registerEventSeries registers the user for event and every later
+// occurrence of its series, skipping occurrences they already hold or that v
+// may not see.
+func registerEventSeries(stores Stores, v Viewer, userID uuid.UUID, event Event) ([]Registration, error) {
+	if event.SeriesID == nil {
+		return nil, errNotInSeries
+	}
+	var regs []Registration
+	err := stores.Transaction(func(tx Stores) error {
+		occurrences, err := tx.Events.ListSeries(v, *event.SeriesID)
+		if err != nil {
+			return err
+		}
+		for _, occ := range occurrences {
+			if occ.EventDate.Before(event.EventDate) {
+				continue
+			}
+			reg := Registration{
+				EventID:     occ.ID,
+				UserID:      userID,
+				QRCodeToken: uuid.New().String(),
+				Status:      "registered",
+			}
+			created, err := tx.Registrations.CreateIfAbsent(&reg)
+			if err != nil {
+				return err
+			}
+			if created {
+				regs = append(regs, reg)
+			}
+		}
+		return nil
+	})
+	return regs, err
+}
+
+// registerActivitySeries is registerEventSeries for activities. Occurrences
+// that are full or clash with the user's schedule are skipped; any other
+// failure undoes the registrations already made.
+func registerActivitySeries(stores Stores, v Viewer, user User, activity Activity, allowConflicts bool) ([]ActivityRegistration, error) {
+	if activity.SeriesID == nil {
+		return nil, errNotInSeries
+	}
+	var regs []ActivityRegistration
+	err := stores.Transaction(func(tx Stores) error {
+		occurrences, err := tx.Activities.ListSeries(v, *activity.SeriesID)
+		if err != nil {
+			return err
+		}
+		for _, occ := range occurrences {
+			if occ.StartTime.Before(activity.StartTime) {
+				continue
+			}
+			reg, _, err := registerForActivity(tx, user, occ.ID, allowConflicts)
+			switch {
+			case err == nil:
+				regs = append(regs, reg)
+			case errors.Is(err, errAlreadyRegistered), errors.Is(err, errActivityFull), errors.Is(err, errScheduleConflict):
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestSeriesEditLeavesEarlierOccurrences edits the second of three weekly
+// occurrences with scope=series: the first, which may be over, keeps its
+// title and time.
+func TestSeriesEditLeavesEarlierOccurrences(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		start := time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC)
+
+		var created struct {
+			Events     []Event    `json:"events"`
+			Activities []Activity `json:"activities"`
+		}
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/events", admin.Token, map[string]interface{}{
+			"title": "Weekly meetup", "event_date": start, "rrule": "FREQ=WEEKLY;COUNT=3",
+		}, &created)
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/activities", admin.Token, map[string]interface{}{
+			"title": "Weekly lab", "start_time": start, "end_time": start.Add(time.Hour), "rrule": "FREQ=WEEKLY;COUNT=3",
+		}, &created)
+		if len(created.Events) != 3 || len(created.Activities) != 3 {
+			t.Fatalf("created %d events and %d activities", len(created.Events), len(created.Activities))
+		}
+
+		var events []Event
+		second := created.Events[1]
+		ts.mustDo(http.StatusOK, http.MethodPut, "/api/events?scope=series&event_id="+second.ID.String(), admin.Token, map[string]interface{}{
+			"title": "Moved meetup", "event_date": second.EventDate.Add(time.Hour),
+		}, &events)
+		if len(events) != 3 {
+			t.Fatalf("series %+v", events)
+		}
+		for i, event := range events {
+			title, date := "Moved meetup", created.Events[i].EventDate.Add(time.Hour)
+			if i == 0 {
+				title, date = "Weekly meetup", created.Events[i].EventDate
+			}
+			if event.Title != title || !event.EventDate.Equal(date) {
+				t.Errorf("event %d: %q at %v, want %q at %v", i, event.Title, event.EventDate, title, date)
+			}
+		}
+
+		var activities []Activity
+		lab := created.Activities[1]
+		ts.mustDo(http.StatusOK, http.MethodPut, "/api/activities?scope=series&activity_id="+lab.ID.String(), admin.Token, map[string]interface{}{
+			"title": "Moved lab", "start_time": lab.StartTime.Add(time.Hour), "end_time": lab.EndTime.Add(time.Hour),
+		}, &activities)
+		if len(activities) != 3 {
+			t.Fatalf("series %+v", activities)
+		}
+		for i, activity := range activities {
+			title, start := "Moved lab", created.Activities[i].StartTime.Add(time.Hour)
+			if i == 0 {
+				title, start = "Weekly lab", created.Activities[i].StartTime
+			}
+			if activity.Title != title || !activity.StartTime.Equal(start) {
+				t.Errorf("activity %d: %q at %v, want %q at %v", i, activity.Title, activity.StartTime, title, start)
+			}
+		}
+	})
+}
+
+// failingActivityRegistrations fails to store a registration for one
+// activity, as a database error would.
+type failingActivityRegistrations struct {
+	RegistrationStore
+	activityID uuid.UUID
+}
+
+func (s failingActivityRegistrations) CreateActivity(reg *ActivityRegistration) error {
+	if reg.ActivityID == s.activityID {
+		return errors.New("disk full")
+	}
+	return s.RegistrationStore.CreateActivity(reg)
+}
+
+// withRegistrations wraps the registration store of stores and of every
+// transaction they start.
+func withRegistrations(stores Stores, wrap func(RegistrationStore) RegistrationStore) Stores {
+	inner := stores
+	stores.Registrations = wrap(inner.Registrations)
+	stores.transaction = func(fn func(tx Stores) error) error {
+		return inner.Transaction(func(tx Stores) error {
+			return fn(withRegistrations(tx, wrap))
+		})
+	}
+	return stores
+}
+
+func TestRegisterActivitySeries(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			stores := backend.stores(t)
+			var users []User
+			for _, usn := range []string{"1JS21CS001", "1JS21CS002"} {
+				user := User{USN: usn, Role: "student"}
+				if err := stores.Users.Create(&user); err != nil {
+					t.Fatal(err)
+				}
+				users = append(users, user)
+			}
+			alice, bob := users[0], users[1]
+
+			series := Series{Kind: "activity", RRule: "FREQ=WEEKLY;COUNT=3"}
+			if err := stores.Activities.CreateSeries(&series); err != nil {
+				t.Fatal(err)
+			}
+			start := time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC)
+			var labs []Activity
+			for i := range 3 {
+				lab := Activity{Title: "Lab", SeriesID: &series.ID, StartTime: start.AddDate(0, 0, 7*i), EndTime: start.AddDate(0, 0, 7*i).Add(time.Hour)}
+				if i == 1 {
+					lab.Capacity = 1
+				}
+				if err := stores.Activities.Create(&lab); err != nil {
+					t.Fatal(err)
+				}
+				labs = append(labs, lab)
+			}
+			if _, _, err := registerForActivity(stores, bob, labs[1].ID, false); err != nil {
+				t.Fatal(err)
+			}
+			registered := func(activityID uuid.UUID) bool {
+				reg, err := stores.Registrations.FindActivity(activityID, alice.ID)
+				return err == nil && reg.Status == "registered"
+			}
+
+			// A database error on the last occurrence undoes the first.
+			failing := withRegistrations(stores, func(regs RegistrationStore) RegistrationStore {
+				return failingActivityRegistrations{regs, labs[2].ID}
+			})
+			if regs, err := registerActivitySeries(failing, adminViewer, alice, labs[0], false); err == nil {
+				t.Fatalf("registered %d occurrences despite a failure", len(regs))
+			}
+			for i, lab := range labs {
+				if registered(lab.ID) {
+					t.Errorf("occurrence %d kept after the series failed", i)
+				}
+			}
+
+			// The full occurrence is skipped without undoing the others.
+			regs, err := registerActivitySeries(stores, adminViewer, alice, labs[0], false)
+			if err != nil || len(regs) != 2 {
+				t.Fatalf("registered %d occurrences, %v", len(regs), err)
+			}
+			for i, want := range []bool{true, false, true} {
+				if registered(labs[i].ID) != want {
+					t.Errorf("occurrence %d registered %v, want %v", i, !want, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Server holds what the handlers depend on, so they can run against any
+// stores, e.g. newMemoryStores in tests.
+type Server struct {
+	Stores
+	config   Config
+	hub      *Hub
+	files    Storage
+	checkIns chan checkInChange // Drained by runCheckInPublisher
+}
+
+func newServer(config Config, stores Stores, hub *Hub, files Storage) *Server {
+	return &Server{Stores: stores, config: config, hub: hub, files: files, checkIns: make(chan checkInChange, 256)}
+}
+
+// Handler returns the API with CORS headers applied.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if local, ok := s.files.(*LocalStorage); ok {
+		mux.HandleFunc("/uploads/", s.longWrite(http.StripPrefix("/uploads/", local.Handler()).ServeHTTP))
+	}
+	mux.HandleFunc("/api/login", s.handleLogin)
+	mux.HandleFunc("/api/register", s.handleRegister)
+	mux.HandleFunc("/api/rooms", s.handleRooms)
+	mux.HandleFunc("/api/rooms/close", s.adminMiddleware(s.handleCloseRoom))
+	mux.HandleFunc("/api/events", s.handleEvents) // We'll handle role check inside here for GET/POST mix
+	mux.HandleFunc("/api/events/{id}", s.handleEventDetail)
+	mux.HandleFunc("/api/events/{id}/activities", s.handleEventActivities)
+	mux.HandleFunc("/api/events/register", s.authMiddleware(s.handleEventRegister))
+	mux.HandleFunc("/api/events/registrations", s.authMiddleware(s.handleEventRegistrations))
+	mux.HandleFunc("/api/events/registrations/{id}/qr.png", s.longWrite(s.handleRegistrationQR))
+	mux.HandleFunc("/api/events/registrations/{id}/qr.svg", s.longWrite(s.handleRegistrationQR))
+	mux.HandleFunc("/api/events/registrations/{id}/qr-link", s.authMiddleware(s.handleRegistrationQRLink))
+	mux.HandleFunc("/api/events/checkin", s.adminMiddleware(s.handleEventCheckIn))
+	mux.HandleFunc("/api/events/checkout", s.adminMiddleware(s.handleEventCheckOut))
+	mux.HandleFunc("/api/events/attendance", s.adminMiddleware(s.handleEventAttendance))
+	mux.HandleFunc("/api/events/export", s.adminMiddleware(s.longWrite(s.handleEventExport)))
+	mux.HandleFunc("/api/events/checkin/tokens", s.adminMiddleware(s.handleCheckInTokens))
+	mux.HandleFunc("/api/events/checkin/sync", s.adminMiddleware(s.handleCheckInSync))
+	mux.HandleFunc("/api/profile", s.authMiddleware(s.handleProfile))
+	mux.HandleFunc("/api/profile/image", s.authMiddleware(s.longWrite(s.handleProfileImageUpload)))
+	mux.HandleFunc("/api/users", s.authMiddleware(s.handleUserDirectory))
+	mux.HandleFunc("/api/users/{ref}", s.authMiddleware(s.handleUserProfile))
+	mux.HandleFunc("/api/events/{id}/image", s.adminMiddleware(s.longWrite(s.handleEventImageUpload)))
+	mux.HandleFunc("/api/activities/{id}/image", s.adminMiddleware(s.longWrite(s.handleActivityImageUpload)))
+	mux.HandleFunc("/api/groups", s.authMiddleware(s.handleGroups))
+	mux.HandleFunc("/api/groups/{id}", s.authMiddleware(s.handleGroup))
+	mux.HandleFunc("/api/groups/{id}/members", s.authMiddleware(s.handleGroupMembers))
+	mux.HandleFunc("/api/groups/{id}/members/{userId}", s.authMiddleware(s.handleGroupMember))
+	mux.HandleFunc("/api/groups/{id}/join", s.authMiddleware(s.handleGroupJoin))
+	mux.HandleFunc("/api/groups/{id}/requests", s.authMiddleware(s.handleGroupJoinRequests))
+	mux.HandleFunc("/api/groups/{id}/requests/{requestId}", s.authMiddleware(s.handleGroupJoinDecision))
+	mux.HandleFunc("/api/groups/{id}/invite-code", s.authMiddleware(s.handleGroupInviteCode))
+	mux.HandleFunc("/api/activities", s.handleActivities)
+	mux.HandleFunc("/api/activities/register", s.authMiddleware(s.handleActivityRegister))
+	mux.HandleFunc("/api/activities/cancel", s.authMiddleware(s.handleActivityCancel))
+	mux.HandleFunc("/api/activities/checkin", s.adminMiddleware(s.handleActivityCheckIn))
+	mux.HandleFunc("/api/activities/registrations/{id}/qr.png", s.longWrite(s.handleActivityRegistrationQR))
+	mux.HandleFunc("/api/activities/registrations/{id}/qr.svg", s.longWrite(s.handleActivityRegistrationQR))
+	mux.HandleFunc("/api/activities/registrations/{id}/qr-link", s.authMiddleware(s.handleActivityRegistrationQRLink))
+	mux.HandleFunc("/api/checkin/scan", s.adminMiddleware(s.handleScan))
+	mux.HandleFunc("/api/schedule", s.authMiddleware(s.handleMySchedule))
+	mux.HandleFunc("/api/calendar/events.ics", s.handleEventsICal)
+	mux.HandleFunc("/api/calendar/event.ics", s.handleEventICal)
+	mux.HandleFunc("/api/calendar/me.ics", s.handleUserICal)
+	mux.HandleFunc("/api/calendar/token", s.authMiddleware(s.handleCalendarToken))
+	mux.HandleFunc("/api/import", s.adminMiddleware(s.handleImport))
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/ws/checkins", s.handleCheckInStream)
+
+	// Simple CORS wrapper
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// startRoomCleanupTicker closes expired rooms until ctx is cancelled.
+func (s *Server) startRoomCleanupTicker(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RoomCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		closed, err := s.Rooms.CloseExpired(time.Now())
+		if err != nil {
+			log.Printf("Error closing expired rooms: %v", err)
+		} else if closed > 0 {
+			log.Printf("Closed %d expired rooms", closed)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testBackends are the disposable databases every integration test runs
+// against: a migrated SQLite file and the in-memory stores.
+var testBackends = []struct {
+	name   string
+	stores func(t *testing.T) Stores
+}{
+	{"sqlite", sqliteTestStores},
+	{"memory", func(*testing.T) Stores { return newMemoryStores() }},
+}
+
+func sqliteTestStores(t *testing.T) Stores {
+	t.Helper()
+	return newGormStores(sqliteTestDB(t))
+}
+
+// sqliteTestDB is a freshly migrated database file, closed after the test.
+func sqliteTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := emptySQLiteTestDB(t)
+	if err := migrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// emptySQLiteTestDB is a database file with no tables, closed after the test.
+func emptySQLiteTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dialector, err := openSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testServer is the API served over HTTP, with its hub running until
+// stopHub is called.
+type testServer struct {
+	*httptest.Server
+	t       *testing.T
+	stopHub context.CancelFunc
+}
+
+// forEachBackend runs test as a subtest per backend, each with a fresh server.
+func forEachBackend(t *testing.T, test func(t *testing.T, ts *testServer)) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, newTestServer(t, backend.stores(t)))
+		})
+	}
+}
+
+func newTestServer(t *testing.T, stores Stores) *testServer {
+	t.Helper()
+	files, err := NewLocalStorage(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := newHub()
+	ctx, stopHub := context.WithCancel(context.Background())
+	go hub.run(ctx)
+	t.Cleanup(stopHub)
+	config := defaultConfig()
+	config.JWTSecret = "integration-test-secret"
+	server := newServer(config, stores, hub, files)
+	go server.runCheckInPublisher(ctx)
+	ts := &testServer{Server: httptest.NewServer(server.Handler()), t: t, stopHub: stopHub}
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends body as JSON and decodes a successful response into out. It
+// returns the status code.
+func (ts *testServer) do(method, path, token string, body, out interface{}) int {
+	ts.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			ts.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// mustDo is do that fails the test unless the status is want.
+func (ts *testServer) mustDo(want int, method, path, token string, body, out interface{}) {
+	ts.t.Helper()
+	if got := ts.do(method, path, token, body, out); got != want {
+		ts.t.Fatalf("%s %s: status %d, want %d", method, path, got, want)
+	}
+}
+
+type testUser struct {
+	User
+	Token string
+}
+
+func (ts *testServer) register(usn, role string) testUser {
+	ts.t.Helper()
+	var resp struct {
+		Token string `json:"token"`
+		User  User   `json:"user"`
+	}
+	ts.mustDo(http.StatusOK, http.MethodPost, "/api/register", "", map[string]string{"usn": usn, "role": role}, &resp)
+	return testUser{User: resp.User, Token: resp.Token}
+}
+
+// dialRoom joins a chat room and returns the connection along with the
+// status of the handshake.
+func (ts *testServer) dialRoom(roomID string, user testUser) (*websocket.Conn, int) {
+	ts.t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?room=" + roomID + "&usn=" + user.USN + "&userId=" + user.ID.String()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		if resp == nil {
+			ts.t.Fatal(err)
+		}
+		return nil, resp.StatusCode
+	}
+	ts.t.Cleanup(func() { conn.Close() })
+	return conn, resp.StatusCode
+}
+
+func readChatMessage(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// say sends content and waits for it to come back. Once a client has seen
+// its own message it is registered with the hub and gets everything sent
+// after.
+func say(t *testing.T, conn *websocket.Conn, content string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if msg := readChatMessage(t, conn); msg.Content == content {
+			return
+		}
+	}
+}
+
+// TestLongWriteOutlivesWriteTimeout checks that longWrite lifts the server's
+// WriteTimeout for slow responses such as big exports.
+func TestLongWriteOutlivesWriteTimeout(t *testing.T) {
+	config := defaultConfig()
+	config.LongWriteTimeout = 5 * time.Second
+	s := newServer(config, newMemoryStores(), newHub(), nil)
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "export")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		ok      bool
+	}{
+		{"plain", slow, false},
+		{"longWrite", s.longWrite(slow), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(tc.handler)
+			srv.Config.WriteTimeout = 100 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			var body []byte
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if got := err == nil && string(body) == "export"; got != tc.ok {
+				t.Errorf("response %q, %v; want success %v", body, err, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUTCArgsLeavesCallerSliceAlone(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	at := time.Date(2026, 11, 2, 9, 0, 0, 0, ist)
+	args := []interface{}{at, &at, "title"}
+
+	got := utcArgs(args)
+	if got[0].(time.Time).Location() != time.UTC || got[1].(*time.Time).Location() != time.UTC {
+		t.Errorf("converted args %v", got)
+	}
+	if args[0].(time.Time).Location() != ist || args[1] != &at || at.Location() != ist {
+		t.Errorf("caller's args rewritten: %v", args)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocalStorage(dir, "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	url, err := local.Put(ctx, "profiles/a/b.png", strings.NewReader("png"), 3, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/uploads/profiles/a/b.png" {
+		t.Errorf("url %q", url)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "profiles", "a", "b.png")); err != nil || string(data) != "png" {
+		t.Errorf("stored %q, %v", data, err)
+	}
+
+	// Keys cannot climb out of Dir.
+	url, err = local.Put(ctx, "../../escape.png", strings.NewReader("x"), 1, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/uploads/escape.png" {
+		t.Errorf("url %q", url)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.png")); err != nil {
+		t.Error(err)
+	}
+	if _, err := local.Put(ctx, "..", strings.NewReader("x"), 1, "image/png"); err == nil {
+		t.Error("stored a file at the root key")
+	}
+
+	if err := local.Delete(ctx, "profiles/a/b.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Delete(ctx, "profiles/a/b.png"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "profiles", "a", "b.png")); !os.IsNotExist(err) {
+		t.Errorf("file still there: %v", err)
+	}
+}
+
+func TestLocalStorageHandlerHidesDirectories(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Put(context.Background(), "profiles/user/img.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/uploads/", local.Handler()))
+	defer srv.Close()
+
+	for path, want := range map[string]int{
+		"/uploads/profiles/user/img.png": http.StatusOK,
+		"/uploads/":                      http.StatusNotFound,
+		"/uploads/profiles/":             http.StatusNotFound,
+		"/uploads/profiles/user/":        http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: status %d, want %d", path, resp.StatusCode, want)
+		}
+		if want != http.StatusOK && strings.Contains(string(body), "user") {
+			t.Errorf("GET %s lists %q", path, body)
+		}
+	}
+}
+
+// fakeS3 is just enough of the S3 API for S3Storage: PUT and DELETE of
+// path-style object URLs.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	headers map[string]http.Header
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(body)
+		}
+		f.objects[r.URL.Path] = string(body)
+		f.headers[r.URL.Path] = r.Header.Clone()
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked strips the "size;chunk-signature=...\r\n" framing that
+// signed uploads over plain HTTP use.
+func decodeAWSChunked(body []byte) []byte {
+	var out []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return out
+		}
+		hexSize, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(hexSize), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			return out
+		}
+		out = append(out, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{objects: map[string]string{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+
+	s3, err := NewS3Storage(S3Config{Endpoint: endpoint, Bucket: "media", AccessKey: "key", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	url, err := s3.Put(ctx, "events/e/img.jpg", strings.NewReader("jpeg"), 4, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://" + endpoint + "/media/events/e/img.jpg"; url != want {
+		t.Errorf("url %q, want %q", url, want)
+	}
+	if got := fake.objects["/media/events/e/img.jpg"]; got != "jpeg" {
+		t.Errorf("stored %q", got)
+	}
+	header := fake.headers["/media/events/e/img.jpg"]
+	if header.Get("Content-Type") != "image/jpeg" || !strings.Contains(header.Get("Cache-Control"), "immutable") {
+		t.Errorf("headers %v", header)
+	}
+	if !strings.Contains(header.Get("Authorization"), "Credential=key/") {
+		t.Errorf("request not signed with the access key: %q", header.Get("Authorization"))
+	}
+
+	if err := s3.Delete(ctx, "events/e/img.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["/media/events/e/img.jpg"]; ok {
+		t.Error("object not deleted")
+	}
+
+	cdn, err := NewS3Storage(S3Config{Endpoint: endpoint, Bucket: "media", PublicURL: "https://cdn.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url, err := cdn.Put(ctx, "a.png", strings.NewReader("png"), 3, "image/png"); err != nil || url != "https://cdn.example.com/a.png" {
+		t.Errorf("url %q, %v", url, err)
+	}
+
+	if _, err := NewS3Storage(S3Config{Endpoint: endpoint}); err == nil {
+		t.Error("accepted a config without a bucket")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The handlers reach the database only through these stores. newGormStores
+// backs them with Postgres or SQLite; newMemoryStores keeps everything in
+// maps, for tests and trying the API without a database.
+//
+// Lookups of a single record fail with gorm.ErrRecordNotFound and inserts
+// that break a unique constraint with gorm.ErrDuplicatedKey, whatever the
+// implementation.
+
+// Stores bundles one store of each kind.
+type Stores struct {
+	Users         UserStore
+	Rooms         RoomStore
+	Messages      MessageStore
+	Events        EventStore
+	Registrations RegistrationStore
+	Activities    ActivityStore
+	Groups        GroupStore
+
+	transaction func(fn func(tx Stores) error) error
+}
+
+// Transaction runs fn with stores whose writes are committed together when
+// fn returns nil and rolled back otherwise.
+func (s Stores) Transaction(fn func(tx Stores) error) error {
+	return s.transaction(fn)
+}
+
+// Viewer is who a query of members-only events and activities runs for.
+// Admins see everything; the zero Viewer only sees unrestricted records.
+type Viewer struct {
+	UserID uuid.UUID
+	Admin  bool
+}
+
+// adminViewer is used where restrictions don't apply, e.g. admin edits.
+var adminViewer = Viewer{Admin: true}
+
+func (s *Server) viewerFromRequest(r *http.Request) Viewer {
+	return Viewer{UserID: s.getUserIDFromToken(r), Admin: s.getRoleFromToken(r) == "admin"}
+}
+
+// UserChanges lists the user fields to update; nil fields are left alone.
+type UserChanges struct {
+	Name          *string
+	Bio           *string
+	ProfileImage  *string
+	CalendarToken *string
+	Privacy       *PrivacySettings
+}
+
+// UserQuery filters the member directory. Zero fields don't filter.
+type UserQuery struct {
+	Text            string // Matches name, case-insensitively
+	MatchUSN        bool   // Text also matches USN
+	AdmissionYear   int
+	Branch          string
+	GroupID         uuid.UUID
+	IncludeUnlisted bool // Also users who left the directory
+	ShowingGroups   bool // Only users who show their groups
+	Limit, Offset   int
+}
+
+type UserStore interface {
+	Create(user *User) error
+	Get(id uuid.UUID) (User, error)
+	// GetByUSN also finds accounts whose USN predates normalization.
+	GetByUSN(usn string) (User, error)
+	GetByCalendarToken(token string) (User, error)
+	// GetProfile loads the user with their memberships and activity
+	// registrations.
+	GetProfile(id uuid.UUID) (User, error)
+	Update(id uuid.UUID, changes UserChanges) error
+	// Search returns one page of matching users, with their memberships,
+	// ordered by name and USN, along with the total number of matches.
+	Search(q UserQuery) ([]User, int64, error)
+}
+
+type RoomStore interface {
+	Create(room *Room) error
+	Get(id string) (Room, error)
+	ListOpen(now time.Time) ([]Room, error)
+	Close(id string) error
+	CloseForGroup(groupID uuid.UUID) error
+	// CloseExpired closes open rooms past their expiry and returns how many.
+	CloseExpired(now time.Time) (int64, error)
+}
+
+type MessageStore interface {
+	Create(msg *Message) error
+	// History returns up to limit messages of a room, oldest first.
+	History(roomID string, limit int) ([]Message, error)
+}
+
+// EventChanges lists the event fields to update; nil fields are left alone.
+type EventChanges struct {
+	Title       *string
+	Description *string
+	Category    *string
+	ImageUrl    *string
+	Location    *string
+	Capacity    *int
+	EventDate   *time.Time
+}
+
+type EventStore interface {
+	// List returns the events v may see dated from onwards, with their
+	// groups, in date order.
+	List(v Viewer, from time.Time) ([]Event, error)
+	Get(id uuid.UUID) (Event, error)
+	GetWithGroups(id uuid.UUID) (Event, error)
+	// GetWithAgenda loads the event with its groups and the activities of
+	// its agenda v may see.
+	GetWithAgenda(v Viewer, id uuid.UUID) (Event, error)
+	GetByExternalID(externalID string) (Event, error)
+	CanAccess(v Viewer, id uuid.UUID) bool
+	// ListSeries returns the occurrences of a series v may see, with their
+	// groups, in date order.
+	ListSeries(v Viewer, seriesID uuid.UUID) ([]Event, error)
+	IDs() ([]uuid.UUID, error)
+	// Attended lists the events v may see that the user checked in to, most
+	// recent first.
+	Attended(v Viewer, userID uuid.UUID) ([]Event, error)
+	Create(event *Event) error
+	CreateSeries(series *Series) error
+	Update(ids []uuid.UUID, changes EventChanges) error
+	// SetGroups replaces the groups the events are restricted to.
+	SetGroups(eventIDs, groupIDs []uuid.UUID) error
+	// Upsert creates the event, or updates the one with the same ExternalID,
+	// and reports whether it was created.
+	Upsert(event *Event) (bool, error)
+}
+
+// ActivityChanges lists the activity fields to update; nil fields are left
+// alone.
+type ActivityChanges struct {
+	Title       *string
+	Description *string
+	ImageUrl    *string
+	Location    *string
+	Capacity    *int
+	StartTime   *time.Time
+	EndTime     *time.Time
+}
+
+type ActivityStore interface {
+	// List returns the activities v may see, optionally of one event only,
+	// with their groups, by start time.
+	List(v Viewer, eventID *uuid.UUID) ([]Activity, error)
+	Get(id uuid.UUID) (Activity, error)
+	GetWithGroups(id uuid.UUID) (Activity, error)
+	// GetForUpdate is Get that also locks the activity until the
+	// transaction ends.
+	GetForUpdate(id uuid.UUID) (Activity, error)
+	GetByExternalID(externalID string) (Activity, error)
+	CanAccess(v Viewer, id uuid.UUID) bool
+	ListSeries(v Viewer, seriesID uuid.UUID) ([]Activity, error)
+	Create(activity *Activity) error
+	CreateSeries(series *Series) error
+	Update(ids []uuid.UUID, changes ActivityChanges) error
+	SetGroups(activityIDs, groupIDs []uuid.UUID) error
+	Upsert(activity *Activity) (bool, error)
+}
+
+// RegistrationExportRow is one line of an event's registration export.
+type RegistrationExportRow struct {
+	ID           uuid.UUID
+	USN          string
+	Name         string
+	Groups       string // Comma-separated group names
+	Status       string
+	CreatedAt    time.Time
+	CheckedInAt  *time.Time
+	CheckedOutAt *time.Time
+}
+
+// RegistrationStore holds event registrations with their attendance
+// sessions, and activity registrations.
+type RegistrationStore interface {
+	Create(reg *Registration) error
+	// CreateIfAbsent is Create that does nothing, and reports false, if the
+	// user is already registered for the event.
+	CreateIfAbsent(reg *Registration) (bool, error)
+	Get(id uuid.UUID) (Registration, error)
+	Find(eventID, userID uuid.UUID) (Registration, error)
+	// GetByToken loads the registration with its user and event.
+	GetByToken(token string) (Registration, error)
+	// GetByTokenForUpdate is GetByToken that also locks the registration
+	// until the surrounding transaction ends.
+	GetByTokenForUpdate(token string) (Registration, error)
+	ListForEvent(eventID uuid.UUID) ([]Registration, error)
+	ListForUser(userID uuid.UUID) ([]Registration, error)
+	// ListActiveForEvent returns the registrations that aren't cancelled,
+	// with their users.
+	ListActiveForEvent(eventID uuid.UUID) ([]Registration, error)
+	// ListActiveForUser returns the registrations that aren't cancelled,
+	// with their events.
+	ListActiveForUser(userID uuid.UUID) ([]Registration, error)
+	// ListAttended returns the registrations that checked in at least once,
+	// with their users, by first check-in.
+	ListAttended(eventID uuid.UUID) ([]Registration, error)
+	Sessions(regIDs []uuid.UUID) ([]AttendanceSession, error)
+	StatusCounts(eventID uuid.UUID) (map[string]int64, error)
+	CountCheckedIn(eventID uuid.UUID) (int64, error)
+	// CheckIn opens an attendance session; the registration's CheckedInAt
+	// keeps the first entry.
+	CheckIn(reg *Registration, at time.Time) error
+	// CheckOut closes the open attendance session, or records the visit as
+	// one session if it was checked in before sessions were tracked.
+	CheckOut(reg *Registration, at time.Time) error
+	// BackdateCheckIn moves the first entry, and that of the earliest
+	// session, back to at.
+	BackdateCheckIn(reg *Registration, at time.Time) error
+	// Export calls fn for every registration of the event, ordered by USN.
+	// fn may be slow, e.g. writing to a client, so Export must not keep
+	// other queries waiting meanwhile.
+	Export(eventID uuid.UUID, fn func(RegistrationExportRow) error) error
+
+	CreateActivity(reg *ActivityRegistration) error
+	GetActivity(id uuid.UUID) (ActivityRegistration, error)
+	FindActivity(activityID, userID uuid.UUID) (ActivityRegistration, error)
+	// GetActivityByToken loads the registration with its user and activity.
+	GetActivityByToken(token string) (ActivityRegistration, error)
+	// GetActivityByTokenForUpdate is GetActivityByToken that also locks the
+	// registration until the surrounding transaction ends.
+	GetActivityByTokenForUpdate(token string) (ActivityRegistration, error)
+	// ListActiveActivitiesForUser returns the user's activity registrations
+	// that aren't cancelled, with their activities.
+	ListActiveActivitiesForUser(userID uuid.UUID) ([]ActivityRegistration, error)
+	CountActiveForActivity(activityID uuid.UUID) (int64, error)
+	// ActivityConflicts returns the activities the user is registered for
+	// that overlap activity. Back-to-back slots don't overlap.
+	ActivityConflicts(userID uuid.UUID, activity Activity) ([]Activity, error)
+	SetActivityStatus(reg *ActivityRegistration, status string) error
+	CheckInActivity(reg *ActivityRegistration, at time.Time) error
+}
+
+type GroupStore interface {
+	List() ([]Group, error)
+	Get(id uuid.UUID) (Group, error)
+	Create(group *Group) error
+	Save(group *Group) error
+	// Delete removes the group with its memberships and join requests.
+	Delete(id uuid.UUID) error
+	// CountExisting counts how many of ids name a group.
+	CountExisting(ids []uuid.UUID) (int64, error)
+	// RestrictsContent reports whether any event or activity is limited to
+	// the group's members.
+	RestrictsContent(groupID uuid.UUID) (bool, error)
+	Membership(userID, groupID uuid.UUID) (GroupMembership, error)
+	// Members lists memberships with their users, ordered by USN.
+	Members(groupID uuid.UUID) ([]GroupMembership, error)
+	// AddMember adds the user with the given role, unless already a member.
+	AddMember(userID, groupID uuid.UUID, role string) error
+	SetRole(userID, groupID uuid.UUID, role string) error
+	RemoveMember(userID, groupID uuid.UUID) error
+	CreateRequest(req *GroupJoinRequest) error
+	GetRequest(groupID, id uuid.UUID) (GroupJoinRequest, error)
+	PendingRequest(groupID, userID uuid.UUID) (GroupJoinRequest, error)
+	// PendingRequests lists undecided requests with their users, oldest
+	// first.
+	PendingRequests(groupID uuid.UUID) ([]GroupJoinRequest, error)
+	SaveRequest(req *GroupJoinRequest) error
+}
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newGormStores backs the stores with db. Inside Transaction they share one
+// database transaction.
+func newGormStores(db *gorm.DB) Stores {
+	return Stores{
+		Users:         gormUserStore{db},
+		Rooms:         gormRoomStore{db},
+		Messages:      gormMessageStore{db},
+		Events:        gormEventStore{db},
+		Registrations: gormRegistrationStore{db},
+		Activities:    gormActivityStore{db},
+		Groups:        gormGroupStore{db},
+		transaction: func(fn func(tx Stores) error) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				return fn(newGormStores(tx))
+			})
+		},
+	}
+}
+
+type gormUserStore struct{ db *gorm.DB }
+
+func (s gormUserStore) Create(user *User) error {
+	return s.db.Create(user).Error
+}
+
+func (s gormUserStore) Get(id uuid.UUID) (User, error) {
+	var user User
+	err := s.db.First(&user, "id = ?", id).Error
+	return user, err
+}
+
+func (s gormUserStore) GetByUSN(usn string) (User, error) {
+	var user User
+	err := s.db.Where("usn = ?", usn).First(&user).Error
+	if err != nil {
+		err = s.db.Where("UPPER(usn) = ?", strings.ToUpper(usn)).First(&user).Error
+	}
+	return user, err
+}
+
+func (s gormUserStore) GetByCalendarToken(token string) (User, error) {
+	var user User
+	err := s.db.Where("calendar_token = ?", token).First(&user).Error
+	return user, err
+}
+
+func (s gormUserStore) GetProfile(id uuid.UUID) (User, error) {
+	var user User
+	err := s.db.Preload("Memberships.Group").Preload("ActivityRegistrations.Activity").First(&user, "id = ?", id).Error
+	return user, err
+}
+
+func (s gormUserStore) Update(id uuid.UUID, changes UserChanges) error {
+	updates := map[string]interface{}{}
+	if changes.Name != nil {
+		updates["name"] = *changes.Name
+	}
+	if changes.Bio != nil {
+		updates["bio"] = *changes.Bio
+	}
+	if changes.ProfileImage != nil {
+		updates["profile_image"] = *changes.ProfileImage
+	}
+	if changes.CalendarToken != nil {
+		updates["calendar_token"] = *changes.CalendarToken
+	}
+	if p := changes.Privacy; p != nil {
+		updates["privacy_listed_in_directory"] = p.ListedInDirectory
+		updates["privacy_show_groups"] = p.ShowGroups
+		updates["privacy_show_attendance"] = p.ShowAttendance
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	// A map update writes empty strings too, and bumps UpdatedAt.
+	return s.db.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// likeEscaper makes user input match literally in a LIKE pattern with
+// ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s gormUserStore) Search(q UserQuery) ([]User, int64, error) {
+	query := s.db.Model(&User{})
+	if !q.IncludeUnlisted {
+		query = query.Where("privacy_listed_in_directory = ?", true)
+	}
+	if q.Text != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q.Text)) + "%"
+		if q.MatchUSN {
+			query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(usn) LIKE ? ESCAPE '\')`, pattern, pattern)
+		} else {
+			query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, pattern)
+		}
+	}
+	if q.AdmissionYear != 0 {
+		query = query.Where("admission_year = ?", q.AdmissionYear)
+	}
+	if q.Branch != "" {
+		query = query.Where("branch = ?", q.Branch)
+	}
+	if q.GroupID != uuid.Nil {
+		query = query.Where("EXISTS (SELECT 1 FROM group_memberships WHERE group_memberships.user_id = users.id AND group_memberships.group_id = ?)", q.GroupID)
+	}
+	if q.ShowingGroups {
+		query = query.Where("privacy_show_groups = ?", true)
+	}
+
+	// Count and Find each need their own copy of the conditions.
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []User
+	err := query.Preload("Memberships.Group").Order("name asc, usn asc").Limit(q.Limit).Offset(q.Offset).Find(&users).Error
+	return users, total, err
+}
+
+type gormRoomStore struct{ db *gorm.DB }
+
+func (s gormRoomStore) Create(room *Room) error {
+	return s.db.Create(room).Error
+}
+
+func (s gormRoomStore) Get(id string) (Room, error) {
+	var room Room
+	err := s.db.First(&room, "id = ?", id).Error
+	return room, err
+}
+
+func (s gormRoomStore) ListOpen(now time.Time) ([]Room, error) {
+	var rooms []Room
+	err := s.db.Where("is_closed = ? AND expires_at > ?", false, now).Order("created_at desc").Find(&rooms).Error
+	return rooms, err
+}
+
+func (s gormRoomStore) Close(id string) error {
+	return s.db.Model(&Room{}).Where("id = ?", id).Update("is_closed", true).Error
+}
+
+func (s gormRoomStore) CloseForGroup(groupID uuid.UUID) error {
+	return s.db.Model(&Room{}).Where("group_id = ?", groupID).Update("is_closed", true).Error
+}
+
+func (s gormRoomStore) CloseExpired(now time.Time) (int64, error) {
+	result := s.db.Model(&Room{}).Where("is_closed = ? AND expires_at < ?", false, now).Update("is_closed", true)
+	return result.RowsAffected, result.Error
+}
+
+type gormMessageStore struct{ db *gorm.DB }
+
+func (s gormMessageStore) Create(msg *Message) error {
+	return s.db.Create(msg).Error
+}
+
+func (s gormMessageStore) History(roomID string, limit int) ([]Message, error) {
+	var history []Message
+	err := s.db.Where("room_id = ?", roomID).Order("created_at asc").Limit(limit).Find(&history).Error
+	return history, err
+}
+
+type gormEventStore struct{ db *gorm.DB }
+
+func (s gormEventStore) List(v Viewer, from time.Time) ([]Event, error) {
+	query := s.db.Preload("Groups").Scopes(visibleEvents(v))
+	if !from.IsZero() {
+		query = query.Where("event_date >= ?", from)
+	}
+	var events []Event
+	err := query.Order("event_date asc").Find(&events).Error
+	return events, err
+}
+
+func (s gormEventStore) Get(id uuid.UUID) (Event, error) {
+	var event Event
+	err := s.db.First(&event, "id = ?", id).Error
+	return event, err
+}
+
+func (s gormEventStore) GetWithGroups(id uuid.UUID) (Event, error) {
+	var event Event
+	err := s.db.Preload("Groups").First(&event, "id = ?", id).Error
+	return event, err
+}
+
+func (s gormEventStore) GetWithAgenda(v Viewer, id uuid.UUID) (Event, error) {
+	var event Event
+	err := s.db.Preload("Groups").Preload("Activities", func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(visibleActivities(v)).Order("start_time asc")
+	}).First(&event, "id = ?", id).Error
+	return event, err
+}
+
+func (s gormEventStore) GetByExternalID(externalID string) (Event, error) {
+	var event Event
+	err := s.db.Where("external_id = ?", externalID).First(&event).Error
+	return event, err
+}
+
+func (s gormEventStore) CanAccess(v Viewer, id uuid.UUID) bool {
+	var count int64
+	s.db.Model(&Event{}).Scopes(visibleEvents(v)).Where("events.id = ?", id).Count(&count)
+	return count > 0
+}
+
+func (s gormEventStore) ListSeries(v Viewer, seriesID uuid.UUID) ([]Event, error) {
+	var events []Event
+	err := s.db.Preload("Groups").Scopes(visibleEvents(v)).Where("series_id = ?", seriesID).Order("event_date asc").Find(&events).Error
+	return events, err
+}
+
+func (s gormEventStore) IDs() ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&Event{}).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (s gormEventStore) Attended(v Viewer, userID uuid.UUID) ([]Event, error) {
+	var events []Event
+	err := s.db.Scopes(visibleEvents(v)).
+		Joins("JOIN registrations ON registrations.event_id = events.id").
+		Where("registrations.user_id = ? AND registrations.status IN ?", userID, []string{"checked_in", "checked_out"}).
+		Order("events.event_date desc").
+		Find(&events).Error
+	return events, err
+}
+
+func (s gormEventStore) Create(event *Event) error {
+	return s.db.Create(event).Error
+}
+
+func (s gormEventStore) CreateSeries(series *Series) error {
+	return s.db.Create(series).Error
+}
+
+func (s gormEventStore) Update(ids []uuid.UUID, changes EventChanges) error {
+	updates := map[string]interface{}{}
+	if changes.Title != nil {
+		updates["title"] = *changes.Title
+	}
+	if changes.Description != nil {
+		updates["description"] = *changes.Description
+	}
+	if changes.Category != nil {
+		updates["category"] = *changes.Category
+	}
+	if changes.ImageUrl != nil {
+		updates["image_url"] = *changes.ImageUrl
+	}
+	if changes.Location != nil {
+		updates["location"] = *changes.Location
+	}
+	if changes.Capacity != nil {
+		updates["capacity"] = *changes.Capacity
+	}
+	if changes.EventDate != nil {
+		updates["event_date"] = *changes.EventDate
+	}
+	if len(updates) == 0 || len(ids) == 0 {
+		return nil
+	}
+	return s.db.Model(&Event{}).Where("id IN ?", ids).Updates(updates).Error
+}
+
+// SetGroups writes the join rows directly: saving through the Groups
+// association would run Group's BeforeCreate and insert copies of the groups.
+func (s gormEventStore) SetGroups(eventIDs, groupIDs []uuid.UUID) error {
+	return replaceGroupLinks(s.db, "event_groups", "event_id", eventIDs, groupIDs)
+}
+
+func (s gormEventStore) Upsert(event *Event) (bool, error) {
+	var existing Event
+	if err := s.db.Where("external_id = ?", event.ExternalID).First(&existing).Error; err == nil {
+		event.ID = existing.ID
+		return false, s.db.Model(&existing).Select("Title", "Description", "Category", "ImageUrl", "Location", "Capacity", "OrganizerID", "EventDate").Updates(event).Error
+	}
+	return true, s.db.Create(event).Error
+}
+
+type gormActivityStore struct{ db *gorm.DB }
+
+func (s gormActivityStore) List(v Viewer, eventID *uuid.UUID) ([]Activity, error) {
+	query := s.db.Preload("Groups").Scopes(visibleActivities(v)).Order("start_time asc")
+	if eventID != nil {
+		query = query.Where("event_id = ?", *eventID)
+	}
+	var activities []Activity
+	err := query.Find(&activities).Error
+	return activities, err
+}
+
+func (s gormActivityStore) Get(id uuid.UUID) (Activity, error) {
+	var activity Activity
+	err := s.db.First(&activity, "id = ?", id).Error
+	return activity, err
+}
+
+func (s gormActivityStore) GetWithGroups(id uuid.UUID) (Activity, error) {
+	var activity Activity
+	err := s.db.Preload("Groups").First(&activity, "id = ?", id).Error
+	return activity, err
+}
+
+func (s gormActivityStore) GetForUpdate(id uuid.UUID) (Activity, error) {
+	var activity Activity
+	err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&activity, "id = ?", id).Error
+	return activity, err
+}
+
+func (s gormActivityStore) GetByExternalID(externalID string) (Activity, error) {
+	var activity Activity
+	err := s.db.Where("external_id = ?", externalID).First(&activity).Error
+	return activity, err
+}
+
+func (s gormActivityStore) CanAccess(v Viewer, id uuid.UUID) bool {
+	var count int64
+	s.db.Model(&Activity{}).Scopes(visibleActivities(v)).Where("activities.id = ?", id).Count(&count)
+	return count > 0
+}
+
+func (s gormActivityStore) ListSeries(v Viewer, seriesID uuid.UUID) ([]Activity, error) {
+	var activities []Activity
+	err := s.db.Preload("Groups").Scopes(visibleActivities(v)).Where("series_id = ?", seriesID).Order("start_time asc").Find(&activities).Error
+	return activities, err
+}
+
+func (s gormActivityStore) Create(activity *Activity) error {
+	return s.db.Create(activity).Error
+}
+
+func (s gormActivityStore) CreateSeries(series *Series) error {
+	return s.db.Create(series).Error
+}
+
+func (s gormActivityStore) Update(ids []uuid.UUID, changes ActivityChanges) error {
+	updates := map[string]interface{}{}
+	if changes.Title != nil {
+		updates["title"] = *changes.Title
+	}
+	if changes.Description != nil {
+		updates["description"] = *changes.Description
+	}
+	if changes.ImageUrl != nil {
+		updates["image_url"] = *changes.ImageUrl
+	}
+	if changes.Location != nil {
+		updates["location"] = *changes.Location
+	}
+	if changes.Capacity != nil {
+		updates["capacity"] = *changes.Capacity
+	}
+	if changes.StartTime != nil {
+		updates["start_time"] = *changes.StartTime
+	}
+	if changes.EndTime != nil {
+		updates["end_time"] = *changes.EndTime
+	}
+	if len(updates) == 0 || len(ids) == 0 {
+		return nil
+	}
+	return s.db.Model(&Activity{}).Where("id IN ?", ids).Updates(updates).Error
+}
+
+func (s gormActivityStore) SetGroups(activityIDs, groupIDs []uuid.UUID) error {
+	return replaceGroupLinks(s.db, "activity_groups", "activity_id", activityIDs, groupIDs)
+}
+
+func (s gormActivityStore) Upsert(activity *Activity) (bool, error) {
+	var existing Activity
+	if err := s.db.Where("external_id = ?", activity.ExternalID).First(&existing).Error; err == nil {
+		activity.ID = existing.ID
+		return false, s.db.Model(&existing).Select("EventID", "Title", "Description", "ImageUrl", "Location", "Capacity", "StartTime", "EndTime").Updates(activity).Error
+	}
+	return true, s.db.Create(activity).Error
+}
+
+type gormRegistrationStore struct{ db *gorm.DB }
+
+func (s gormRegistrationStore) Create(reg *Registration) error {
+	return s.db.Create(reg).Error
+}
+
+func (s gormRegistrationStore) CreateIfAbsent(reg *Registration) (bool, error) {
+	// A failed insert would abort the surrounding transaction, so let the
+	// unique index turn it into a no-op instead.
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(reg)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s gormRegistrationStore) Get(id uuid.UUID) (Registration, error) {
+	var reg Registration
+	err := s.db.First(&reg, "id = ?", id).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) Find(eventID, userID uuid.UUID) (Registration, error) {
+	var reg Registration
+	err := s.db.Where("event_id = ? AND user_id = ?", eventID, userID).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) GetByToken(token string) (Registration, error) {
+	var reg Registration
+	err := s.db.Preload("User").Preload("Event").Where("qr_code_token = ?", token).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) GetByTokenForUpdate(token string) (Registration, error) {
+	var reg Registration
+	err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").Preload("Event").
+		Where("qr_code_token = ?", token).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) ListForEvent(eventID uuid.UUID) ([]Registration, error) {
+	var regs []Registration
+	err := s.db.Where("event_id = ?", eventID).Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) ListForUser(userID uuid.UUID) ([]Registration, error) {
+	var regs []Registration
+	err := s.db.Where("user_id = ?", userID).Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) ListActiveForEvent(eventID uuid.UUID) ([]Registration, error) {
+	var regs []Registration
+	err := s.db.Preload("User").Where("event_id = ? AND status <> ?", eventID, "cancelled").Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) ListActiveForUser(userID uuid.UUID) ([]Registration, error) {
+	var regs []Registration
+	err := s.db.Preload("Event").Where("user_id = ? AND status <> ?", userID, "cancelled").Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) ListAttended(eventID uuid.UUID) ([]Registration, error) {
+	var regs []Registration
+	err := s.db.Preload("User").Where("event_id = ? AND checked_in_at IS NOT NULL", eventID).Order("checked_in_at asc").Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) Sessions(regIDs []uuid.UUID) ([]AttendanceSession, error) {
+	var sessions []AttendanceSession
+	if len(regIDs) == 0 {
+		return sessions, nil
+	}
+	err := s.db.Where("registration_id IN ?", regIDs).Order("checked_in_at asc").Find(&sessions).Error
+	return sessions, err
+}
+
+func (s gormRegistrationStore) StatusCounts(eventID uuid.UUID) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := s.db.Model(&Registration{}).Select("status, count(*) as count").Where("event_id = ?", eventID).Group("status").Scan(&rows).Error
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, err
+}
+
+func (s gormRegistrationStore) CountCheckedIn(eventID uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&Registration{}).Where("event_id = ? AND checked_in_at IS NOT NULL", eventID).Count(&count).Error
+	return count, err
+}
+
+func (s gormRegistrationStore) CheckIn(reg *Registration, at time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"status": "checked_in"}
+		if reg.CheckedInAt == nil {
+			updates["checked_in_at"] = at
+		}
+		if err := tx.Model(&Registration{}).Where("id = ?", reg.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&AttendanceSession{RegistrationID: reg.ID, CheckedInAt: at}).Error; err != nil {
+			return err
+		}
+
+		reg.Status = "checked_in"
+		if reg.CheckedInAt == nil {
+			reg.CheckedInAt = &at
+		}
+		return nil
+	})
+}
+
+func (s gormRegistrationStore) CheckOut(reg *Registration, at time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&AttendanceSession{}).
+			Where("registration_id = ? AND checked_out_at IS NULL", reg.ID).
+			Update("checked_out_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			start := at
+			if reg.CheckedInAt != nil {
+				start = *reg.CheckedInAt
+			}
+			if err := tx.Create(&AttendanceSession{RegistrationID: reg.ID, CheckedInAt: start, CheckedOutAt: &at}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Registration{}).Where("id = ?", reg.ID).Updates(map[string]interface{}{
+			"status":         "checked_out",
+			"checked_out_at": at,
+		}).Error; err != nil {
+			return err
+		}
+
+		reg.Status = "checked_out"
+		reg.CheckedOutAt = &at
+		return nil
+	})
+}
+
+func (s gormRegistrationStore) BackdateCheckIn(reg *Registration, at time.Time) error {
+	if err := s.db.Model(&Registration{}).Where("id = ?", reg.ID).Update("checked_in_at", at).Error; err != nil {
+		return err
+	}
+	var first AttendanceSession
+	if err := s.db.Where("registration_id = ?", reg.ID).Order("checked_in_at asc").First(&first).Error; err == nil {
+		if err := s.db.Model(&first).Update("checked_in_at", at).Error; err != nil {
+			return err
+		}
+	}
+	reg.CheckedInAt = &at
+	return nil
+}
+
+func (s gormRegistrationStore) Export(eventID uuid.UUID, fn func(RegistrationExportRow) error) error {
+	rows, err := s.db.Table("registrations").
+		Select("registrations.id, users.usn, users.name, "+
+			"("+userGroupNamesSQL(s.db)+"), "+
+			"registrations.status, registrations.created_at, registrations.checked_in_at, registrations.checked_out_at").
+		Joins("LEFT JOIN users ON users.id = registrations.user_id").
+		Where("registrations.event_id = ?", eventID).
+		Order("users.usn asc").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Streaming holds a connection until the last row is written. With only
+	// one, as on SQLite, that would stall every other request behind a slow
+	// download, so read the rows first.
+	emit := fn
+	var buffered []RegistrationExportRow
+	if singleConnection(s.db) {
+		emit = func(row RegistrationExportRow) error {
+			buffered = append(buffered, row)
+			return nil
+		}
+	}
+
+	for rows.Next() {
+		var (
+			row               RegistrationExportRow
+			usn, name, groups *string
+		)
+		if err := rows.Scan(&row.ID, &usn, &name, &groups, &row.Status, &row.CreatedAt, &row.CheckedInAt, &row.CheckedOutAt); err != nil {
+			return err
+		}
+		row.USN, row.Name, row.Groups = deref(usn), deref(name), deref(groups)
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, row := range buffered {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// singleConnection reports whether db's pool is limited to one connection.
+func singleConnection(db *gorm.DB) bool {
+	sqlDB, err := db.DB()
+	return err == nil && sqlDB.Stats().MaxOpenConnections == 1
+}
+
+// userGroupNamesSQL selects the comma-separated names of the groups of
+// users.id in name order.
+func userGroupNamesSQL(db *gorm.DB) string {
+	if db.Dialector.Name() == "sqlite" {
+		// group_concat has no ORDER BY before SQLite 3.44; it keeps the
+		// order of a sorted subquery instead.
+		return "SELECT group_concat(name, ', ') FROM (SELECT groups.name FROM group_memberships JOIN groups ON groups.id = group_memberships.group_id WHERE group_memberships.user_id = users.id ORDER BY groups.name)"
+	}
+	return "SELECT string_agg(groups.name, ', ' ORDER BY groups.name) FROM group_memberships JOIN groups ON groups.id = group_memberships.group_id WHERE group_memberships.user_id = users.id"
+}
+
+func (s gormRegistrationStore) CreateActivity(reg *ActivityRegistration) error {
+	return s.db.Create(reg).Error
+}
+
+func (s gormRegistrationStore) GetActivity(id uuid.UUID) (ActivityRegistration, error) {
+	var reg ActivityRegistration
+	err := s.db.First(&reg, "id = ?", id).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) FindActivity(activityID, userID uuid.UUID) (ActivityRegistration, error) {
+	var reg ActivityRegistration
+	err := s.db.Where("activity_id = ? AND user_id = ?", activityID, userID).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) GetActivityByToken(token string) (ActivityRegistration, error) {
+	var reg ActivityRegistration
+	err := s.db.Preload("User").Preload("Activity").Where("qr_code_token = ?", token).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) GetActivityByTokenForUpdate(token string) (ActivityRegistration, error) {
+	var reg ActivityRegistration
+	err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").Preload("Activity").
+		Where("qr_code_token = ?", token).First(&reg).Error
+	return reg, err
+}
+
+func (s gormRegistrationStore) ListActiveActivitiesForUser(userID uuid.UUID) ([]ActivityRegistration, error) {
+	var regs []ActivityRegistration
+	err := s.db.Preload("Activity").Where("user_id = ? AND status <> ?", userID, "cancelled").Find(&regs).Error
+	return regs, err
+}
+
+func (s gormRegistrationStore) CountActiveForActivity(activityID uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&ActivityRegistration{}).Where("activity_id = ? AND status <> ?", activityID, "cancelled").Count(&count).Error
+	return count, err
+}
+
+func (s gormRegistrationStore) ActivityConflicts(userID uuid.UUID, activity Activity) ([]Activity, error) {
+	var overlaps []Activity
+	err := s.db.Joins("JOIN activity_registrations ON activity_registrations.activity_id = activities.id").
+		Where("activity_registrations.user_id = ? AND activity_registrations.status <> ?", userID, "cancelled").
+		Where("activities.id <> ? AND activities.start_time < ? AND activities.end_time > ?", activity.ID, activity.EndTime, activity.StartTime).
+		Order("activities.start_time asc").
+		Find(&overlaps).Error
+	return overlaps, err
+}
+
+func (s gormRegistrationStore) SetActivityStatus(reg *ActivityRegistration, status string) error {
+	if err := s.db.Model(&ActivityRegistration{}).Where("id = ?", reg.ID).Update("status", status).Error; err != nil {
+		return err
+	}
+	reg.Status = status
+	return nil
+}
+
+func (s gormRegistrationStore) CheckInActivity(reg *ActivityRegistration, at time.Time) error {
+	if err := s.db.Model(&ActivityRegistration{}).Where("id = ?", reg.ID).Updates(map[string]interface{}{
+		"status":        "checked_in",
+		"checked_in_at": at,
+	}).Error; err != nil {
+		return err
+	}
+	reg.Status = "checked_in"
+	reg.CheckedInAt = &at
+	return nil
+}
+
+type gormGroupStore struct{ db *gorm.DB }
+
+func (s gormGroupStore) List() ([]Group, error) {
+	var groups []Group
+	err := s.db.Find(&groups).Error
+	return groups, err
+}
+
+func (s gormGroupStore) Get(id uuid.UUID) (Group, error) {
+	var group Group
+	err := s.db.First(&group, "id = ?", id).Error
+	return group, err
+}
+
+func (s gormGroupStore) Create(group *Group) error {
+	return s.db.Create(group).Error
+}
+
+func (s gormGroupStore) Save(group *Group) error {
+	return s.db.Save(group).Error
+}
+
+func (s gormGroupStore) Delete(id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&GroupMembership{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&GroupJoinRequest{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Group{}, "id = ?", id).Error
+	})
+}
+
+func (s gormGroupStore) CountExisting(ids []uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&Group{}).Where("id IN ?", ids).Count(&count).Error
+	return count, err
+}
+
+func (s gormGroupStore) RestrictsContent(groupID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.db.Table("event_groups").Where("group_id = ?", groupID).Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	err := s.db.Table("activity_groups").Where("group_id = ?", groupID).Count(&count).Error
+	return count > 0, err
+}
+
+func (s gormGroupStore) Membership(userID, groupID uuid.UUID) (GroupMembership, error) {
+	var m GroupMembership
+	err := s.db.Where("user_id = ? AND group_id = ?", userID, groupID).First(&m).Error
+	return m, err
+}
+
+func (s gormGroupStore) Members(groupID uuid.UUID) ([]GroupMembership, error) {
+	members := []GroupMembership{}
+	err := s.db.Preload("User").
+		Joins("JOIN users ON users.id = group_memberships.user_id").
+		Where("group_memberships.group_id = ?", groupID).
+		Order("users.usn asc").
+		Find(&members).Error
+	return members, err
+}
+
+func (s gormGroupStore) AddMember(userID, groupID uuid.UUID, role string) error {
+	if _, err := s.Membership(userID, groupID); err == nil {
+		return nil
+	}
+	return s.db.Create(&GroupMembership{GroupID: groupID, UserID: userID, Role: role}).Error
+}
+
+func (s gormGroupStore) SetRole(userID, groupID uuid.UUID, role string) error {
+	return s.db.Model(&GroupMembership{}).Where("user_id = ? AND group_id = ?", userID, groupID).Update("role", role).Error
+}
+
+func (s gormGroupStore) RemoveMember(userID, groupID uuid.UUID) error {
+	return s.db.Where("user_id = ? AND group_id = ?", userID, groupID).Delete(&GroupMembership{}).Error
+}
+
+func (s gormGroupStore) CreateRequest(req *GroupJoinRequest) error {
+	return s.db.Create(req).Error
+}
+
+func (s gormGroupStore) GetRequest(groupID, id uuid.UUID) (GroupJoinRequest, error) {
+	var req GroupJoinRequest
+	err := s.db.Where("id = ? AND group_id = ?", id, groupID).First(&req).Error
+	return req, err
+}
+
+func (s gormGroupStore) PendingRequest(groupID, userID uuid.UUID) (GroupJoinRequest, error) {
+	var req GroupJoinRequest
+	err := s.db.Where("group_id = ? AND user_id = ? AND status = ?", groupID, userID, "pending").First(&req).Error
+	return req, err
+}
+
+func (s gormGroupStore) PendingRequests(groupID uuid.UUID) ([]GroupJoinRequest, error) {
+	requests := []GroupJoinRequest{}
+	err := s.db.Preload("User").Where("group_id = ? AND status = ?", groupID, "pending").Order("created_at asc").Find(&requests).Error
+	return requests, err
+}
+
+func (s gormGroupStore) SaveRequest(req *GroupJoinRequest) error {
+	return s.db.Omit(clause.Associations).Save(req).Error
+}
@@ -0,0 +1,1392 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memoryTables holds the records of the in-memory stores. Associations are
+// never stored; they are attached to copies when a query preloads them.
+type memoryTables struct {
+	users          map[uuid.UUID]User
+	rooms          map[string]Room
+	messages       []Message
+	events         map[uuid.UUID]Event
+	series         map[uuid.UUID]Series
+	eventGroups    map[uuid.UUID][]uuid.UUID
+	activities     map[uuid.UUID]Activity
+	activityGroups map[uuid.UUID][]uuid.UUID
+	registrations  map[uuid.UUID]Registration
+	sessions       map[uuid.UUID]AttendanceSession
+	activityRegs   map[uuid.UUID]ActivityRegistration
+	groups         map[uuid.UUID]Group
+	memberships    map[uuid.UUID]GroupMembership
+	requests       map[uuid.UUID]GroupJoinRequest
+}
+
+func (t *memoryTables) clone() memoryTables {
+	return memoryTables{
+		users:          maps.Clone(t.users),
+		rooms:          maps.Clone(t.rooms),
+		messages:       append([]Message(nil), t.messages...),
+		events:         maps.Clone(t.events),
+		series:         maps.Clone(t.series),
+		eventGroups:    maps.Clone(t.eventGroups),
+		activities:     maps.Clone(t.activities),
+		activityGroups: maps.Clone(t.activityGroups),
+		registrations:  maps.Clone(t.registrations),
+		sessions:       maps.Clone(t.sessions),
+		activityRegs:   maps.Clone(t.activityRegs),
+		groups:         maps.Clone(t.groups),
+		memberships:    maps.Clone(t.memberships),
+		requests:       maps.Clone(t.requests),
+	}
+}
+
+// memoryDB is what every in-memory store works on. A transaction holds mu
+// for its whole run, so the stores it hands out must not lock again.
+type memoryDB struct {
+	*memoryTables
+	mu   *sync.Mutex
+	held bool
+}
+
+func (db memoryDB) lock() func() {
+	if db.held {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// newMemoryStores keeps everything in maps, with the same constraints as the
+// database: unique keys, foreign keys and column defaults. Transactions are
+// serialized and restore a snapshot when rolled back.
+func newMemoryStores() Stores {
+	return memoryStores(memoryDB{
+		memoryTables: &memoryTables{
+			users:          map[uuid.UUID]User{},
+			rooms:          map[string]Room{},
+			events:         map[uuid.UUID]Event{},
+			series:         map[uuid.UUID]Series{},
+			eventGroups:    map[uuid.UUID][]uuid.UUID{},
+			activities:     map[uuid.UUID]Activity{},
+			activityGroups: map[uuid.UUID][]uuid.UUID{},
+			registrations:  map[uuid.UUID]Registration{},
+			sessions:       map[uuid.UUID]AttendanceSession{},
+			activityRegs:   map[uuid.UUID]ActivityRegistration{},
+			groups:         map[uuid.UUID]Group{},
+			memberships:    map[uuid.UUID]GroupMembership{},
+			requests:       map[uuid.UUID]GroupJoinRequest{},
+		},
+		mu: &sync.Mutex{},
+	})
+}
+
+func memoryStores(db memoryDB) Stores {
+	return Stores{
+		Users:         memoryUserStore{db},
+		Rooms:         memoryRoomStore{db},
+		Messages:      memoryMessageStore{db},
+		Events:        memoryEventStore{db},
+		Registrations: memoryRegistrationStore{db},
+		Activities:    memoryActivityStore{db},
+		Groups:        memoryGroupStore{db},
+		transaction: func(fn func(tx Stores) error) error {
+			defer db.lock()()
+			saved := db.clone()
+			tx := db
+			tx.held = true
+			if err := fn(memoryStores(tx)); err != nil {
+				*db.memoryTables = saved
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// valuesOf returns the values of m that keep accepts, in no particular order.
+func valuesOf[K comparable, V any](m map[K]V, keep func(V) bool) []V {
+	out := []V{}
+	for _, v := range m {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (db memoryDB) isMember(userID, groupID uuid.UUID) bool {
+	for _, m := range db.memberships {
+		if m.UserID == userID && m.GroupID == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// memberOfAny mirrors the EXISTS half of eventVisibleSQL: no groups means
+// unrestricted.
+func (db memoryDB) memberOfAny(v Viewer, groupIDs []uuid.UUID) bool {
+	if v.Admin || len(groupIDs) == 0 {
+		return true
+	}
+	for _, groupID := range groupIDs {
+		if db.isMember(v.UserID, groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db memoryDB) eventVisible(v Viewer, id uuid.UUID) bool {
+	return db.memberOfAny(v, db.eventGroups[id])
+}
+
+func (db memoryDB) activityVisible(v Viewer, a Activity) bool {
+	if !db.memberOfAny(v, db.activityGroups[a.ID]) {
+		return false
+	}
+	return a.EventID == nil || db.eventVisible(v, *a.EventID)
+}
+
+func (db memoryDB) groupsOf(ids []uuid.UUID) []Group {
+	groups := []Group{}
+	for _, id := range ids {
+		if g, ok := db.groups[id]; ok {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func (db memoryDB) withEventGroups(events []Event) []Event {
+	for i := range events {
+		events[i].Groups = db.groupsOf(db.eventGroups[events[i].ID])
+	}
+	return events
+}
+
+func (db memoryDB) withActivityGroups(activities []Activity) []Activity {
+	for i := range activities {
+		activities[i].Groups = db.groupsOf(db.activityGroups[activities[i].ID])
+	}
+	return activities
+}
+
+func (db memoryDB) userRef(id uuid.UUID) *User {
+	if u, ok := db.users[id]; ok {
+		return &u
+	}
+	return nil
+}
+
+func (db memoryDB) membershipsOf(userID uuid.UUID) []GroupMembership {
+	ms := valuesOf(db.memberships, func(m GroupMembership) bool { return m.UserID == userID })
+	sort.Slice(ms, func(i, j int) bool { return ms[i].CreatedAt.Before(ms[j].CreatedAt) })
+	for i := range ms {
+		if g, ok := db.groups[ms[i].GroupID]; ok {
+			ms[i].Group = &g
+		}
+	}
+	return ms
+}
+
+func (db memoryDB) setGroupLinks(links map[uuid.UUID][]uuid.UUID, ownerIDs, groupIDs []uuid.UUID) error {
+	for _, groupID := range groupIDs {
+		if _, ok := db.groups[groupID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+	}
+	for _, ownerID := range ownerIDs {
+		if ids := uniqueIDs(groupIDs); len(ids) > 0 {
+			links[ownerID] = ids
+		} else {
+			delete(links, ownerID)
+		}
+	}
+	return nil
+}
+
+func sameString(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+type memoryUserStore struct{ memoryDB }
+
+func (s memoryUserStore) Create(user *User) error {
+	defer s.lock()()
+	for _, u := range s.users {
+		if u.USN == user.USN || sameString(u.CalendarToken, user.CalendarToken) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	user.BeforeCreate(nil)
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	// Column defaults apply to false just as to any other zero value.
+	user.Privacy.ListedInDirectory = true
+	user.Privacy.ShowGroups = true
+	now := time.Now()
+	user.CreatedAt, user.UpdatedAt = now, now
+
+	stored := *user
+	stored.Memberships, stored.ActivityRegistrations = nil, nil
+	s.users[user.ID] = stored
+	return nil
+}
+
+func (s memoryUserStore) Get(id uuid.UUID) (User, error) {
+	defer s.lock()()
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return User{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryUserStore) GetByUSN(usn string) (User, error) {
+	defer s.lock()()
+	for _, u := range s.users {
+		if u.USN == usn {
+			return u, nil
+		}
+	}
+	for _, u := range s.users {
+		if strings.ToUpper(u.USN) == strings.ToUpper(usn) {
+			return u, nil
+		}
+	}
+	return User{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryUserStore) GetByCalendarToken(token string) (User, error) {
+	defer s.lock()()
+	for _, u := range s.users {
+		if sameString(u.CalendarToken, &token) {
+			return u, nil
+		}
+	}
+	return User{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryUserStore) GetProfile(id uuid.UUID) (User, error) {
+	defer s.lock()()
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, gorm.ErrRecordNotFound
+	}
+	user.Memberships = s.membershipsOf(id)
+	regs := valuesOf(s.activityRegs, func(reg ActivityRegistration) bool { return reg.UserID == id })
+	sort.Slice(regs, func(i, j int) bool { return regs[i].CreatedAt.Before(regs[j].CreatedAt) })
+	for i := range regs {
+		if a, ok := s.activities[regs[i].ActivityID]; ok {
+			regs[i].Activity = &a
+		}
+	}
+	user.ActivityRegistrations = regs
+	return user, nil
+}
+
+func (s memoryUserStore) Update(id uuid.UUID, changes UserChanges) error {
+	defer s.lock()()
+	user, ok := s.users[id]
+	if !ok {
+		return nil
+	}
+	if changes.Name != nil {
+		user.Name = *changes.Name
+	}
+	if changes.Bio != nil {
+		user.Bio = *changes.Bio
+	}
+	if changes.ProfileImage != nil {
+		user.ProfileImage = *changes.ProfileImage
+	}
+	if changes.CalendarToken != nil {
+		for _, u := range s.users {
+			if u.ID != id && sameString(u.CalendarToken, changes.CalendarToken) {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		token := *changes.CalendarToken
+		user.CalendarToken = &token
+	}
+	if changes.Privacy != nil {
+		user.Privacy = *changes.Privacy
+	}
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+func (s memoryUserStore) Search(q UserQuery) ([]User, int64, error) {
+	defer s.lock()()
+	text := strings.ToLower(q.Text)
+	users := valuesOf(s.users, func(u User) bool {
+		switch {
+		case !q.IncludeUnlisted && !u.Privacy.ListedInDirectory:
+			return false
+		case text != "" && !strings.Contains(strings.ToLower(u.Name), text) && !(q.MatchUSN && strings.Contains(strings.ToLower(u.USN), text)):
+			return false
+		case q.AdmissionYear != 0 && u.AdmissionYear != q.AdmissionYear:
+			return false
+		case q.Branch != "" && u.Branch != q.Branch:
+			return false
+		case q.GroupID != uuid.Nil && !s.isMember(u.ID, q.GroupID):
+			return false
+		case q.ShowingGroups && !u.Privacy.ShowGroups:
+			return false
+		}
+		return true
+	})
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Name != users[j].Name {
+			return users[i].Name < users[j].Name
+		}
+		return users[i].USN < users[j].USN
+	})
+
+	total := int64(len(users))
+	users = users[min(q.Offset, len(users)):]
+	if q.Limit > 0 && q.Limit < len(users) {
+		users = users[:q.Limit]
+	}
+	for i := range users {
+		users[i].Memberships = s.membershipsOf(users[i].ID)
+	}
+	return users, total, nil
+}
+
+type memoryRoomStore struct{ memoryDB }
+
+func (s memoryRoomStore) Create(room *Room) error {
+	defer s.lock()()
+	room.BeforeCreate(nil)
+	if _, ok := s.rooms[room.ID]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	room.CreatedAt = time.Now()
+	s.rooms[room.ID] = *room
+	return nil
+}
+
+func (s memoryRoomStore) Get(id string) (Room, error) {
+	defer s.lock()()
+	if room, ok := s.rooms[id]; ok {
+		return room, nil
+	}
+	return Room{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryRoomStore) ListOpen(now time.Time) ([]Room, error) {
+	defer s.lock()()
+	rooms := valuesOf(s.rooms, func(room Room) bool { return !room.IsClosed && room.ExpiresAt.After(now) })
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].CreatedAt.After(rooms[j].CreatedAt) })
+	return rooms, nil
+}
+
+func (s memoryRoomStore) Close(id string) error {
+	defer s.lock()()
+	if room, ok := s.rooms[id]; ok {
+		room.IsClosed = true
+		s.rooms[id] = room
+	}
+	return nil
+}
+
+func (s memoryRoomStore) CloseForGroup(groupID uuid.UUID) error {
+	defer s.lock()()
+	for id, room := range s.rooms {
+		if room.GroupID != nil && *room.GroupID == groupID {
+			room.IsClosed = true
+			s.rooms[id] = room
+		}
+	}
+	return nil
+}
+
+func (s memoryRoomStore) CloseExpired(now time.Time) (int64, error) {
+	defer s.lock()()
+	var closed int64
+	for id, room := range s.rooms {
+		if !room.IsClosed && room.ExpiresAt.Before(now) {
+			room.IsClosed = true
+			s.rooms[id] = room
+			closed++
+		}
+	}
+	return closed, nil
+}
+
+type memoryMessageStore struct{ memoryDB }
+
+func (s memoryMessageStore) Create(msg *Message) error {
+	defer s.lock()()
+	if _, ok := s.rooms[msg.RoomID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	msg.BeforeCreate(nil)
+	msg.CreatedAt = time.Now()
+	s.messages = append(s.messages, *msg)
+	return nil
+}
+
+func (s memoryMessageStore) History(roomID string, limit int) ([]Message, error) {
+	defer s.lock()()
+	// Messages are appended in creation order already.
+	history := []Message{}
+	for _, msg := range s.messages {
+		if msg.RoomID == roomID && len(history) < limit {
+			history = append(history, msg)
+		}
+	}
+	return history, nil
+}
+
+type memoryEventStore struct{ memoryDB }
+
+func (s memoryEventStore) List(v Viewer, from time.Time) ([]Event, error) {
+	defer s.lock()()
+	events := valuesOf(s.events, func(e Event) bool {
+		return s.eventVisible(v, e.ID) && (from.IsZero() || !e.EventDate.Before(from))
+	})
+	sort.Slice(events, func(i, j int) bool { return events[i].EventDate.Before(events[j].EventDate) })
+	return s.withEventGroups(events), nil
+}
+
+func (s memoryEventStore) Get(id uuid.UUID) (Event, error) {
+	defer s.lock()()
+	if event, ok := s.events[id]; ok {
+		return event, nil
+	}
+	return Event{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryEventStore) GetWithGroups(id uuid.UUID) (Event, error) {
+	defer s.lock()()
+	event, ok := s.events[id]
+	if !ok {
+		return Event{}, gorm.ErrRecordNotFound
+	}
+	event.Groups = s.groupsOf(s.eventGroups[id])
+	return event, nil
+}
+
+func (s memoryEventStore) GetWithAgenda(v Viewer, id uuid.UUID) (Event, error) {
+	defer s.lock()()
+	event, ok := s.events[id]
+	if !ok {
+		return Event{}, gorm.ErrRecordNotFound
+	}
+	event.Groups = s.groupsOf(s.eventGroups[id])
+	event.Activities = valuesOf(s.activities, func(a Activity) bool {
+		return a.EventID != nil && *a.EventID == id && s.activityVisible(v, a)
+	})
+	sort.Slice(event.Activities, func(i, j int) bool { return event.Activities[i].StartTime.Before(event.Activities[j].StartTime) })
+	return event, nil
+}
+
+func (s memoryEventStore) GetByExternalID(externalID string) (Event, error) {
+	defer s.lock()()
+	for _, event := range s.events {
+		if sameString(event.ExternalID, &externalID) {
+			return event, nil
+		}
+	}
+	return Event{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryEventStore) CanAccess(v Viewer, id uuid.UUID) bool {
+	defer s.lock()()
+	_, ok := s.events[id]
+	return ok && s.eventVisible(v, id)
+}
+
+func (s memoryEventStore) ListSeries(v Viewer, seriesID uuid.UUID) ([]Event, error) {
+	defer s.lock()()
+	events := valuesOf(s.events, func(e Event) bool {
+		return e.SeriesID != nil && *e.SeriesID == seriesID && s.eventVisible(v, e.ID)
+	})
+	sort.Slice(events, func(i, j int) bool { return events[i].EventDate.Before(events[j].EventDate) })
+	return s.withEventGroups(events), nil
+}
+
+func (s memoryEventStore) IDs() ([]uuid.UUID, error) {
+	defer s.lock()()
+	ids := make([]uuid.UUID, 0, len(s.events))
+	for id := range s.events {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s memoryEventStore) Attended(v Viewer, userID uuid.UUID) ([]Event, error) {
+	defer s.lock()()
+	events := []Event{}
+	for _, reg := range s.registrations {
+		if reg.UserID != userID || (reg.Status != "checked_in" && reg.Status != "checked_out") {
+			continue
+		}
+		if event, ok := s.events[reg.EventID]; ok && s.eventVisible(v, event.ID) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].EventDate.After(events[j].EventDate) })
+	return events, nil
+}
+
+func (s memoryEventStore) Create(event *Event) error {
+	defer s.lock()()
+	for _, e := range s.events {
+		if sameString(e.ExternalID, event.ExternalID) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	event.BeforeCreate(nil)
+	event.CreatedAt = time.Now()
+
+	stored := *event
+	stored.Activities, stored.Groups = nil, nil
+	s.events[event.ID] = stored
+	return nil
+}
+
+func (s memoryEventStore) CreateSeries(series *Series) error {
+	defer s.lock()()
+	series.BeforeCreate(nil)
+	series.CreatedAt = time.Now()
+	s.series[series.ID] = *series
+	return nil
+}
+
+func (s memoryEventStore) Update(ids []uuid.UUID, changes EventChanges) error {
+	defer s.lock()()
+	for _, id := range ids {
+		event, ok := s.events[id]
+		if !ok {
+			continue
+		}
+		if changes.Title != nil {
+			event.Title = *changes.Title
+		}
+		if changes.Description != nil {
+			event.Description = *changes.Description
+		}
+		if changes.Category != nil {
+			event.Category = *changes.Category
+		}
+		if changes.ImageUrl != nil {
+			event.ImageUrl = *changes.ImageUrl
+		}
+		if changes.Location != nil {
+			event.Location = *changes.Location
+		}
+		if changes.Capacity != nil {
+			event.Capacity = *changes.Capacity
+		}
+		if changes.EventDate != nil {
+			event.EventDate = *changes.EventDate
+		}
+		s.events[id] = event
+	}
+	return nil
+}
+
+func (s memoryEventStore) SetGroups(eventIDs, groupIDs []uuid.UUID) error {
+	defer s.lock()()
+	return s.setGroupLinks(s.eventGroups, eventIDs, groupIDs)
+}
+
+func (s memoryEventStore) Upsert(event *Event) (bool, error) {
+	defer s.lock()()
+	for id, existing := range s.events {
+		if !sameString(existing.ExternalID, event.ExternalID) {
+			continue
+		}
+		event.ID = id
+		existing.Title, existing.Description, existing.Category = event.Title, event.Description, event.Category
+		existing.ImageUrl, existing.Location, existing.Capacity = event.ImageUrl, event.Location, event.Capacity
+		existing.OrganizerID, existing.EventDate = event.OrganizerID, event.EventDate
+		s.events[id] = existing
+		return false, nil
+	}
+	held := s
+	held.held = true
+	return true, held.Create(event)
+}
+
+type memoryActivityStore struct{ memoryDB }
+
+func (s memoryActivityStore) List(v Viewer, eventID *uuid.UUID) ([]Activity, error) {
+	defer s.lock()()
+	activities := valuesOf(s.activities, func(a Activity) bool {
+		if eventID != nil && (a.EventID == nil || *a.EventID != *eventID) {
+			return false
+		}
+		return s.activityVisible(v, a)
+	})
+	sort.Slice(activities, func(i, j int) bool { return activities[i].StartTime.Before(activities[j].StartTime) })
+	return s.withActivityGroups(activities), nil
+}
+
+func (s memoryActivityStore) Get(id uuid.UUID) (Activity, error) {
+	defer s.lock()()
+	if activity, ok := s.activities[id]; ok {
+		return activity, nil
+	}
+	return Activity{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryActivityStore) GetWithGroups(id uuid.UUID) (Activity, error) {
+	defer s.lock()()
+	activity, ok := s.activities[id]
+	if !ok {
+		return Activity{}, gorm.ErrRecordNotFound
+	}
+	activity.Groups = s.groupsOf(s.activityGroups[id])
+	return activity, nil
+}
+
+// GetForUpdate needs no lock of its own: transactions already run one at a
+// time.
+func (s memoryActivityStore) GetForUpdate(id uuid.UUID) (Activity, error) {
+	return s.Get(id)
+}
+
+func (s memoryActivityStore) GetByExternalID(externalID string) (Activity, error) {
+	defer s.lock()()
+	for _, activity := range s.activities {
+		if sameString(activity.ExternalID, &externalID) {
+			return activity, nil
+		}
+	}
+	return Activity{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryActivityStore) CanAccess(v Viewer, id uuid.UUID) bool {
+	defer s.lock()()
+	activity, ok := s.activities[id]
+	return ok && s.activityVisible(v, activity)
+}
+
+func (s memoryActivityStore) ListSeries(v Viewer, seriesID uuid.UUID) ([]Activity, error) {
+	defer s.lock()()
+	activities := valuesOf(s.activities, func(a Activity) bool {
+		return a.SeriesID != nil && *a.SeriesID == seriesID && s.activityVisible(v, a)
+	})
+	sort.Slice(activities, func(i, j int) bool { return activities[i].StartTime.Before(activities[j].StartTime) })
+	return s.withActivityGroups(activities), nil
+}
+
+func (s memoryActivityStore) Create(activity *Activity) error {
+	defer s.lock()()
+	if activity.EventID != nil {
+		if _, ok := s.events[*activity.EventID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+	}
+	for _, a := range s.activities {
+		if sameString(a.ExternalID, activity.ExternalID) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	activity.BeforeCreate(nil)
+	activity.CreatedAt = time.Now()
+
+	stored := *activity
+	stored.Groups = nil
+	s.activities[activity.ID] = stored
+	return nil
+}
+
+func (s memoryActivityStore) CreateSeries(series *Series) error {
+	return memoryEventStore(s).CreateSeries(series)
+}
+
+func (s memoryActivityStore) Update(ids []uuid.UUID, changes ActivityChanges) error {
+	defer s.lock()()
+	for _, id := range ids {
+		activity, ok := s.activities[id]
+		if !ok {
+			continue
+		}
+		if changes.Title != nil {
+			activity.Title = *changes.Title
+		}
+		if changes.Description != nil {
+			activity.Description = *changes.Description
+		}
+		if changes.ImageUrl != nil {
+			activity.ImageUrl = *changes.ImageUrl
+		}
+		if changes.Location != nil {
+			activity.Location = *changes.Location
+		}
+		if changes.Capacity != nil {
+			activity.Capacity = *changes.Capacity
+		}
+		if changes.StartTime != nil {
+			activity.StartTime = *changes.StartTime
+		}
+		if changes.EndTime != nil {
+			activity.EndTime = *changes.EndTime
+		}
+		s.activities[id] = activity
+	}
+	return nil
+}
+
+func (s memoryActivityStore) SetGroups(activityIDs, groupIDs []uuid.UUID) error {
+	defer s.lock()()
+	return s.setGroupLinks(s.activityGroups, activityIDs, groupIDs)
+}
+
+func (s memoryActivityStore) Upsert(activity *Activity) (bool, error) {
+	defer s.lock()()
+	for id, existing := range s.activities {
+		if !sameString(existing.ExternalID, activity.ExternalID) {
+			continue
+		}
+		if activity.EventID != nil {
+			if _, ok := s.events[*activity.EventID]; !ok {
+				return false, gorm.ErrForeignKeyViolated
+			}
+		}
+		activity.ID = id
+		existing.EventID, existing.Title, existing.Description = activity.EventID, activity.Title, activity.Description
+		existing.ImageUrl, existing.Location, existing.Capacity = activity.ImageUrl, activity.Location, activity.Capacity
+		existing.StartTime, existing.EndTime = activity.StartTime, activity.EndTime
+		s.activities[id] = existing
+		return false, nil
+	}
+	held := s
+	held.held = true
+	return true, held.Create(activity)
+}
+
+type memoryRegistrationStore struct{ memoryDB }
+
+func (s memoryRegistrationStore) Create(reg *Registration) error {
+	defer s.lock()()
+	return s.create(reg)
+}
+
+func (s memoryRegistrationStore) create(reg *Registration) error {
+	if _, ok := s.events[reg.EventID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	if _, ok := s.users[reg.UserID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	for _, r := range s.registrations {
+		if (r.EventID == reg.EventID && r.UserID == reg.UserID) || r.QRCodeToken == reg.QRCodeToken {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	reg.BeforeCreate(nil)
+	if reg.Status == "" {
+		reg.Status = "registered"
+	}
+	reg.CreatedAt = time.Now()
+
+	stored := *reg
+	stored.Event, stored.User = nil, nil
+	s.registrations[reg.ID] = stored
+	return nil
+}
+
+func (s memoryRegistrationStore) CreateIfAbsent(reg *Registration) (bool, error) {
+	defer s.lock()()
+	err := s.create(reg)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s memoryRegistrationStore) Get(id uuid.UUID) (Registration, error) {
+	defer s.lock()()
+	if reg, ok := s.registrations[id]; ok {
+		return reg, nil
+	}
+	return Registration{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryRegistrationStore) Find(eventID, userID uuid.UUID) (Registration, error) {
+	defer s.lock()()
+	for _, reg := range s.registrations {
+		if reg.EventID == eventID && reg.UserID == userID {
+			return reg, nil
+		}
+	}
+	return Registration{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryRegistrationStore) GetByToken(token string) (Registration, error) {
+	defer s.lock()()
+	for _, reg := range s.registrations {
+		if reg.QRCodeToken == token {
+			reg.User = s.userRef(reg.UserID)
+			if event, ok := s.events[reg.EventID]; ok {
+				reg.Event = &event
+			}
+			return reg, nil
+		}
+	}
+	return Registration{}, gorm.ErrRecordNotFound
+}
+
+// GetByTokenForUpdate needs no lock of its own: transactions already run one
+// at a time.
+func (s memoryRegistrationStore) GetByTokenForUpdate(token string) (Registration, error) {
+	return s.GetByToken(token)
+}
+
+func (s memoryRegistrationStore) list(keep func(Registration) bool) []Registration {
+	regs := valuesOf(s.registrations, keep)
+	sort.Slice(regs, func(i, j int) bool { return regs[i].CreatedAt.Before(regs[j].CreatedAt) })
+	return regs
+}
+
+func (s memoryRegistrationStore) ListForEvent(eventID uuid.UUID) ([]Registration, error) {
+	defer s.lock()()
+	return s.list(func(reg Registration) bool { return reg.EventID == eventID }), nil
+}
+
+func (s memoryRegistrationStore) ListForUser(userID uuid.UUID) ([]Registration, error) {
+	defer s.lock()()
+	return s.list(func(reg Registration) bool { return reg.UserID == userID }), nil
+}
+
+func (s memoryRegistrationStore) ListActiveForEvent(eventID uuid.UUID) ([]Registration, error) {
+	defer s.lock()()
+	regs := s.list(func(reg Registration) bool { return reg.EventID == eventID && reg.Status != "cancelled" })
+	for i := range regs {
+		regs[i].User = s.userRef(regs[i].UserID)
+	}
+	return regs, nil
+}
+
+func (s memoryRegistrationStore) ListActiveForUser(userID uuid.UUID) ([]Registration, error) {
+	defer s.lock()()
+	regs := s.list(func(reg Registration) bool { return reg.UserID == userID && reg.Status != "cancelled" })
+	for i := range regs {
+		if event, ok := s.events[regs[i].EventID]; ok {
+			regs[i].Event = &event
+		}
+	}
+	return regs, nil
+}
+
+func (s memoryRegistrationStore) ListAttended(eventID uuid.UUID) ([]Registration, error) {
+	defer s.lock()()
+	regs := s.list(func(reg Registration) bool { return reg.EventID == eventID && reg.CheckedInAt != nil })
+	sort.SliceStable(regs, func(i, j int) bool { return regs[i].CheckedInAt.Before(*regs[j].CheckedInAt) })
+	for i := range regs {
+		regs[i].User = s.userRef(regs[i].UserID)
+	}
+	return regs, nil
+}
+
+func (s memoryRegistrationStore) Sessions(regIDs []uuid.UUID) ([]AttendanceSession, error) {
+	defer s.lock()()
+	wanted := make(map[uuid.UUID]bool, len(regIDs))
+	for _, id := range regIDs {
+		wanted[id] = true
+	}
+	sessions := valuesOf(s.sessions, func(session AttendanceSession) bool { return wanted[session.RegistrationID] })
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CheckedInAt.Before(sessions[j].CheckedInAt) })
+	return sessions, nil
+}
+
+func (s memoryRegistrationStore) StatusCounts(eventID uuid.UUID) (map[string]int64, error) {
+	defer s.lock()()
+	counts := map[string]int64{}
+	for _, reg := range s.registrations {
+		if reg.EventID == eventID {
+			counts[reg.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (s memoryRegistrationStore) CountCheckedIn(eventID uuid.UUID) (int64, error) {
+	defer s.lock()()
+	var count int64
+	for _, reg := range s.registrations {
+		if reg.EventID == eventID && reg.CheckedInAt != nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memoryRegistrationStore) addSession(session AttendanceSession) {
+	session.BeforeCreate(nil)
+	session.CreatedAt = time.Now()
+	s.sessions[session.ID] = session
+}
+
+func (s memoryRegistrationStore) CheckIn(reg *Registration, at time.Time) error {
+	defer s.lock()()
+	reg.Status = "checked_in"
+	if reg.CheckedInAt == nil {
+		reg.CheckedInAt = &at
+	}
+	if stored, ok := s.registrations[reg.ID]; ok {
+		stored.Status, stored.CheckedInAt = reg.Status, reg.CheckedInAt
+		s.registrations[reg.ID] = stored
+	}
+	s.addSession(AttendanceSession{RegistrationID: reg.ID, CheckedInAt: at})
+	return nil
+}
+
+func (s memoryRegistrationStore) CheckOut(reg *Registration, at time.Time) error {
+	defer s.lock()()
+	closed := false
+	for id, session := range s.sessions {
+		if session.RegistrationID == reg.ID && session.CheckedOutAt == nil {
+			session.CheckedOutAt = &at
+			s.sessions[id] = session
+			closed = true
+		}
+	}
+	if !closed {
+		// Checked in before sessions were tracked; record the visit as one session.
+		start := at
+		if reg.CheckedInAt != nil {
+			start = *reg.CheckedInAt
+		}
+		s.addSession(AttendanceSession{RegistrationID: reg.ID, CheckedInAt: start, CheckedOutAt: &at})
+	}
+
+	reg.Status = "checked_out"
+	reg.CheckedOutAt = &at
+	if stored, ok := s.registrations[reg.ID]; ok {
+		stored.Status, stored.CheckedOutAt = reg.Status, reg.CheckedOutAt
+		s.registrations[reg.ID] = stored
+	}
+	return nil
+}
+
+func (s memoryRegistrationStore) BackdateCheckIn(reg *Registration, at time.Time) error {
+	defer s.lock()()
+	reg.CheckedInAt = &at
+	if stored, ok := s.registrations[reg.ID]; ok {
+		stored.CheckedInAt = reg.CheckedInAt
+		s.registrations[reg.ID] = stored
+	}
+	var first *AttendanceSession
+	for _, session := range s.sessions {
+		if session.RegistrationID == reg.ID && (first == nil || session.CheckedInAt.Before(first.CheckedInAt)) {
+			session := session
+			first = &session
+		}
+	}
+	if first != nil {
+		first.CheckedInAt = at
+		s.sessions[first.ID] = *first
+	}
+	return nil
+}
+
+// Export calls fn after unlocking, so a slow client does not hold up the
+// other stores.
+func (s memoryRegistrationStore) Export(eventID uuid.UUID, fn func(RegistrationExportRow) error) error {
+	for _, row := range s.exportRows(eventID) {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s memoryRegistrationStore) exportRows(eventID uuid.UUID) []RegistrationExportRow {
+	defer s.lock()()
+	var rows []RegistrationExportRow
+	for _, reg := range s.registrations {
+		if reg.EventID != eventID {
+			continue
+		}
+		row := RegistrationExportRow{
+			ID:           reg.ID,
+			Status:       reg.Status,
+			CreatedAt:    reg.CreatedAt,
+			CheckedInAt:  reg.CheckedInAt,
+			CheckedOutAt: reg.CheckedOutAt,
+		}
+		if user, ok := s.users[reg.UserID]; ok {
+			row.USN, row.Name = user.USN, user.Name
+			var names []string
+			for _, m := range s.membershipsOf(user.ID) {
+				if m.Group != nil {
+					names = append(names, m.Group.Name)
+				}
+			}
+			sort.Strings(names)
+			row.Groups = strings.Join(names, ", ")
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].USN < rows[j].USN })
+	return rows
+}
+
+func (s memoryRegistrationStore) CreateActivity(reg *ActivityRegistration) error {
+	defer s.lock()()
+	if _, ok := s.activities[reg.ActivityID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	if _, ok := s.users[reg.UserID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	reg.BeforeCreate(nil)
+	for _, r := range s.activityRegs {
+		if (r.ActivityID == reg.ActivityID && r.UserID == reg.UserID) || sameString(r.QRCodeToken, reg.QRCodeToken) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if reg.Status == "" {
+		reg.Status = "registered"
+	}
+	reg.CreatedAt = time.Now()
+
+	stored := *reg
+	stored.Activity, stored.User = nil, nil
+	s.activityRegs[reg.ID] = stored
+	return nil
+}
+
+func (s memoryRegistrationStore) GetActivity(id uuid.UUID) (ActivityRegistration, error) {
+	defer s.lock()()
+	if reg, ok := s.activityRegs[id]; ok {
+		return reg, nil
+	}
+	return ActivityRegistration{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryRegistrationStore) FindActivity(activityID, userID uuid.UUID) (ActivityRegistration, error) {
+	defer s.lock()()
+	for _, reg := range s.activityRegs {
+		if reg.ActivityID == activityID && reg.UserID == userID {
+			return reg, nil
+		}
+	}
+	return ActivityRegistration{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryRegistrationStore) GetActivityByToken(token string) (ActivityRegistration, error) {
+	defer s.lock()()
+	for _, reg := range s.activityRegs {
+		if sameString(reg.QRCodeToken, &token) {
+			reg.User = s.userRef(reg.UserID)
+			if activity, ok := s.activities[reg.ActivityID]; ok {
+				reg.Activity = &activity
+			}
+			return reg, nil
+		}
+	}
+	return ActivityRegistration{}, gorm.ErrRecordNotFound
+}
+
+// GetActivityByTokenForUpdate needs no lock of its own: transactions
+// already run one at a time.
+func (s memoryRegistrationStore) GetActivityByTokenForUpdate(token string) (ActivityRegistration, error) {
+	return s.GetActivityByToken(token)
+}
+
+func (s memoryRegistrationStore) ListActiveActivitiesForUser(userID uuid.UUID) ([]ActivityRegistration, error) {
+	defer s.lock()()
+	regs := valuesOf(s.activityRegs, func(reg ActivityRegistration) bool {
+		return reg.UserID == userID && reg.Status != "cancelled"
+	})
+	sort.Slice(regs, func(i, j int) bool { return regs[i].CreatedAt.Before(regs[j].CreatedAt) })
+	for i := range regs {
+		if activity, ok := s.activities[regs[i].ActivityID]; ok {
+			regs[i].Activity = &activity
+		}
+	}
+	return regs, nil
+}
+
+func (s memoryRegistrationStore) CountActiveForActivity(activityID uuid.UUID) (int64, error) {
+	defer s.lock()()
+	var count int64
+	for _, reg := range s.activityRegs {
+		if reg.ActivityID == activityID && reg.Status != "cancelled" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memoryRegistrationStore) ActivityConflicts(userID uuid.UUID, activity Activity) ([]Activity, error) {
+	defer s.lock()()
+	overlaps := []Activity{}
+	for _, reg := range s.activityRegs {
+		if reg.UserID != userID || reg.Status == "cancelled" || reg.ActivityID == activity.ID {
+			continue
+		}
+		other, ok := s.activities[reg.ActivityID]
+		if ok && other.StartTime.Before(activity.EndTime) && other.EndTime.After(activity.StartTime) {
+			overlaps = append(overlaps, other)
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].StartTime.Before(overlaps[j].StartTime) })
+	return overlaps, nil
+}
+
+func (s memoryRegistrationStore) SetActivityStatus(reg *ActivityRegistration, status string) error {
+	defer s.lock()()
+	reg.Status = status
+	if stored, ok := s.activityRegs[reg.ID]; ok {
+		stored.Status = status
+		s.activityRegs[reg.ID] = stored
+	}
+	return nil
+}
+
+func (s memoryRegistrationStore) CheckInActivity(reg *ActivityRegistration, at time.Time) error {
+	defer s.lock()()
+	reg.Status = "checked_in"
+	reg.CheckedInAt = &at
+	if stored, ok := s.activityRegs[reg.ID]; ok {
+		stored.Status, stored.CheckedInAt = reg.Status, reg.CheckedInAt
+		s.activityRegs[reg.ID] = stored
+	}
+	return nil
+}
+
+type memoryGroupStore struct{ memoryDB }
+
+func (s memoryGroupStore) List() ([]Group, error) {
+	defer s.lock()()
+	groups := valuesOf(s.groups, func(Group) bool { return true })
+	sort.Slice(groups, func(i, j int) bool { return groups[i].CreatedAt.Before(groups[j].CreatedAt) })
+	return groups, nil
+}
+
+func (s memoryGroupStore) Get(id uuid.UUID) (Group, error) {
+	defer s.lock()()
+	if group, ok := s.groups[id]; ok {
+		return group, nil
+	}
+	return Group{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryGroupStore) inviteCodeTaken(group *Group) bool {
+	for _, g := range s.groups {
+		if g.ID != group.ID && sameString(g.InviteCode, group.InviteCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memoryGroupStore) Create(group *Group) error {
+	defer s.lock()()
+	group.BeforeCreate(nil)
+	if s.inviteCodeTaken(group) {
+		return gorm.ErrDuplicatedKey
+	}
+	if group.JoinPolicy == "" {
+		group.JoinPolicy = "approval"
+	}
+	now := time.Now()
+	group.CreatedAt, group.UpdatedAt = now, now
+	s.groups[group.ID] = *group
+	return nil
+}
+
+func (s memoryGroupStore) Save(group *Group) error {
+	defer s.lock()()
+	if s.inviteCodeTaken(group) {
+		return gorm.ErrDuplicatedKey
+	}
+	group.UpdatedAt = time.Now()
+	s.groups[group.ID] = *group
+	return nil
+}
+
+func (s memoryGroupStore) Delete(id uuid.UUID) error {
+	defer s.lock()()
+	for _, links := range []map[uuid.UUID][]uuid.UUID{s.eventGroups, s.activityGroups} {
+		for _, groupIDs := range links {
+			for _, groupID := range groupIDs {
+				if groupID == id {
+					return gorm.ErrForeignKeyViolated
+				}
+			}
+		}
+	}
+	for memberID, m := range s.memberships {
+		if m.GroupID == id {
+			delete(s.memberships, memberID)
+		}
+	}
+	for reqID, req := range s.requests {
+		if req.GroupID == id {
+			delete(s.requests, reqID)
+		}
+	}
+	delete(s.groups, id)
+	return nil
+}
+
+func (s memoryGroupStore) CountExisting(ids []uuid.UUID) (int64, error) {
+	defer s.lock()()
+	var count int64
+	for _, id := range ids {
+		if _, ok := s.groups[id]; ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memoryGroupStore) RestrictsContent(groupID uuid.UUID) (bool, error) {
+	defer s.lock()()
+	for _, links := range []map[uuid.UUID][]uuid.UUID{s.eventGroups, s.activityGroups} {
+		for _, groupIDs := range links {
+			for _, id := range groupIDs {
+				if id == groupID {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s memoryGroupStore) membership(userID, groupID uuid.UUID) (GroupMembership, bool) {
+	for _, m := range s.memberships {
+		if m.UserID == userID && m.GroupID == groupID {
+			return m, true
+		}
+	}
+	return GroupMembership{}, false
+}
+
+func (s memoryGroupStore) Membership(userID, groupID uuid.UUID) (GroupMembership, error) {
+	defer s.lock()()
+	if m, ok := s.membership(userID, groupID); ok {
+		return m, nil
+	}
+	return GroupMembership{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryGroupStore) Members(groupID uuid.UUID) ([]GroupMembership, error) {
+	defer s.lock()()
+	members := []GroupMembership{}
+	for _, m := range s.memberships {
+		if m.GroupID == groupID {
+			if m.User = s.userRef(m.UserID); m.User != nil {
+				members = append(members, m)
+			}
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].User.USN < members[j].User.USN })
+	return members, nil
+}
+
+func (s memoryGroupStore) AddMember(userID, groupID uuid.UUID, role string) error {
+	defer s.lock()()
+	if _, ok := s.membership(userID, groupID); ok {
+		return nil
+	}
+	if _, ok := s.groups[groupID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	if _, ok := s.users[userID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	m := GroupMembership{GroupID: groupID, UserID: userID, Role: role, CreatedAt: time.Now()}
+	m.BeforeCreate(nil)
+	if m.Role == "" {
+		m.Role = "member"
+	}
+	s.memberships[m.ID] = m
+	return nil
+}
+
+func (s memoryGroupStore) SetRole(userID, groupID uuid.UUID, role string) error {
+	defer s.lock()()
+	if m, ok := s.membership(userID, groupID); ok {
+		m.Role = role
+		s.memberships[m.ID] = m
+	}
+	return nil
+}
+
+func (s memoryGroupStore) RemoveMember(userID, groupID uuid.UUID) error {
+	defer s.lock()()
+	if m, ok := s.membership(userID, groupID); ok {
+		delete(s.memberships, m.ID)
+	}
+	return nil
+}
+
+func (s memoryGroupStore) CreateRequest(req *GroupJoinRequest) error {
+	defer s.lock()()
+	if _, ok := s.users[req.UserID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	req.BeforeCreate(nil)
+	if req.Status == "" {
+		req.Status = "pending"
+	}
+	req.CreatedAt = time.Now()
+
+	stored := *req
+	stored.User = nil
+	s.requests[req.ID] = stored
+	return nil
+}
+
+func (s memoryGroupStore) GetRequest(groupID, id uuid.UUID) (GroupJoinRequest, error) {
+	defer s.lock()()
+	if req, ok := s.requests[id]; ok && req.GroupID == groupID {
+		return req, nil
+	}
+	return GroupJoinRequest{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryGroupStore) PendingRequest(groupID, userID uuid.UUID) (GroupJoinRequest, error) {
+	defer s.lock()()
+	for _, req := range s.requests {
+		if req.GroupID == groupID && req.UserID == userID && req.Status == "pending" {
+			return req, nil
+		}
+	}
+	return GroupJoinRequest{}, gorm.ErrRecordNotFound
+}
+
+func (s memoryGroupStore) PendingRequests(groupID uuid.UUID) ([]GroupJoinRequest, error) {
+	defer s.lock()()
+	requests := valuesOf(s.requests, func(req GroupJoinRequest) bool {
+		return req.GroupID == groupID && req.Status == "pending"
+	})
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+	for i := range requests {
+		requests[i].User = s.userRef(requests[i].UserID)
+	}
+	return requests, nil
+}
+
+func (s memoryGroupStore) SaveRequest(req *GroupJoinRequest) error {
+	defer s.lock()()
+	stored := *req
+	stored.User = nil
+	s.requests[req.ID] = stored
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxUploadSize     = 5 << 20
+	maxImagePixels    = 40_000_000 // Refuse decompression bombs before decoding
+	maxImageDimension = 1024
+	thumbnailSize     = 256
+)
+
+var (
+	errUploadTooLarge     = errors.New("image must be at most 5 MB")
+	errUnsupportedImage   = errors.New("image must be a JPEG, PNG, GIF or WebP")
+	errImageTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// sniffed content types we accept, and whether to keep them lossless.
+var uploadImageTypes = map[string]bool{
+	"image/jpeg": false,
+	"image/webp": false,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+type processedImage struct {
+	Full, Thumb []byte
+	Ext         string
+	ContentType string
+}
+
+// processImage checks an upload by its content, not its declared type, and
+// re-encodes it: the full image fits in maxImageDimension and the thumbnail
+// is a centre-cropped square. Re-encoding also drops EXIF metadata.
+func processImage(data []byte) (processedImage, error) {
+	lossless, ok := uploadImageTypes[http.DetectContentType(data)]
+	if !ok {
+		return processedImage{}, errUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return processedImage{}, errUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return processedImage{}, errImageTooManyPixels
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return processedImage{}, errUnsupportedImage
+	}
+
+	full := fitImage(src, maxImageDimension)
+	thumb := squareThumbnail(src, thumbnailSize)
+
+	out := processedImage{Ext: ".jpg", ContentType: "image/jpeg"}
+	encode := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), err
+	}
+	if lossless {
+		out.Ext, out.ContentType = ".png", "image/png"
+		encode = func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := png.Encode(&buf, img)
+			return buf.Bytes(), err
+		}
+	}
+	if out.Full, err = encode(full); err != nil {
+		return processedImage{}, err
+	}
+	if out.Thumb, err = encode(thumb); err != nil {
+		return processedImage{}, err
+	}
+	return out, nil
+}
+
+// fitImage scales src down so neither side exceeds limit.
+func fitImage(src image.Image, limit int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return src
+	}
+	if w >= h {
+		h = h * limit / w
+		w = limit
+	} else {
+		w = w * limit / h
+		h = limit
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// squareThumbnail crops the centre square of src and scales it to size.
+func squareThumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x0, y0, x0+side, y0+side), draw.Over, nil)
+	return dst
+}
+
+// readImageUpload returns the "image" file of a multipart upload.
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// Leave room for the multipart envelope around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+64<<10)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errUploadTooLarge
+		}
+		return nil, err
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, errUploadTooLarge
+	}
+	return data, nil
+}
+
+// storeImage processes an upload and stores the image and its thumbnail
+// under prefix. The thumbnail sits next to the image with a "_thumb" suffix.
+func (s *Server) storeImage(ctx context.Context, prefix string, data []byte) (string, string, error) {
+	img, err := processImage(data)
+	if err != nil {
+		return "", "", err
+	}
+	name := prefix + "/" + uuid.New().String()
+	url, err := s.files.Put(ctx, name+img.Ext, bytes.NewReader(img.Full), int64(len(img.Full)), img.ContentType)
+	if err != nil {
+		return "", "", err
+	}
+	thumbURL, err := s.files.Put(ctx, name+"_thumb"+img.Ext, bytes.NewReader(img.Thumb), int64(len(img.Thumb)), img.ContentType)
+	if err != nil {
+		return "", "", err
+	}
+	return url, thumbURL, nil
+}
+
+// handleImageUpload reads, processes and stores an uploaded image, then
+// lets save record the URL. It writes the whole response.
+func (s *Server) handleImageUpload(w http.ResponseWriter, r *http.Request, prefix string, save func(url string) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := readImageUpload(w, r)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Expected a multipart form with an image file", http.StatusBadRequest)
+		return
+	}
+
+	url, thumbURL, err := s.storeImage(r.Context(), prefix, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedImage):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		case errors.Is(err, errImageTooManyPixels):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		default:
+			log.Printf("Image upload failed: %v", err)
+			http.Error(w, "Could not store image", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := save(url); err != nil {
+		http.Error(w, "Could not save image", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"url":           url,
+		"thumbnail_url": thumbURL,
+	})
+}
+
+// handleProfileImageUpload sets the caller's profile image.
+func (s *Server) handleProfileImageUpload(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserIDFromToken(r)
+	if userID == uuid.Nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.handleImageUpload(w, r, "profiles/"+userID.String(), func(url string) error {
+		return s.Users.Update(userID, UserChanges{ProfileImage: &url})
+	})
+}
+
+// handleEventImageUpload sets an event's image.
+func (s *Server) handleEventImageUpload(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.Events.Get(eventID); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	s.handleImageUpload(w, r, "events/"+eventID.String(), func(url string) error {
+		return s.Events.Update([]uuid.UUID{eventID}, EventChanges{ImageUrl: &url})
+	})
+}
+
+// handleActivityImageUpload sets an activity's image.
+func (s *Server) handleActivityImageUpload(w http.ResponseWriter, r *http.Request) {
+	activityID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid activity ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.Activities.Get(activityID); err != nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	s.handleImageUpload(w, r, "activities/"+activityID.String(), func(url string) error {
+		return s.Activities.Update([]uuid.UUID{activityID}, ActivityChanges{ImageUrl: &url})
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader is the start of a PNG claiming to be w×h, which is all
+// DecodeConfig reads.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 4+13)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12], ihdr[13] = 8, 2 // 8-bit RGB
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = binary.BigEndian.AppendUint32(out, 13)
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestProcessImage(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		contentType string
+		full        image.Point
+		err         error
+	}{
+		{"wide png is scaled down", encodePNG(t, testImage(2000, 1000)), "image/png", image.Pt(1024, 512), nil},
+		{"tall jpeg is scaled down", encodeJPEG(t, testImage(600, 3000)), "image/jpeg", image.Pt(204, 1024), nil},
+		{"small jpeg keeps its size", encodeJPEG(t, testImage(300, 200)), "image/jpeg", image.Pt(300, 200), nil},
+		{"text", []byte("definitely not an image"), "", image.Point{}, errUnsupportedImage},
+		{"truncated png", encodePNG(t, testImage(50, 50))[:100], "", image.Point{}, errUnsupportedImage},
+		{"decompression bomb", pngHeader(20000, 20000), "", image.Point{}, errImageTooManyPixels},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := processImage(tc.data)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if out.ContentType != tc.contentType {
+				t.Errorf("content type %q, want %q", out.ContentType, tc.contentType)
+			}
+			full, format, err := image.Decode(bytes.NewReader(out.Full))
+			if err != nil || "image/"+format != tc.contentType {
+				t.Fatalf("full image: %s, %v", format, err)
+			}
+			if got := full.Bounds().Size(); got != tc.full {
+				t.Errorf("full image %v, want %v", got, tc.full)
+			}
+			thumb, _, err := image.Decode(bytes.NewReader(out.Thumb))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := thumb.Bounds().Size(); got != image.Pt(thumbnailSize, thumbnailSize) {
+				t.Errorf("thumbnail %v", got)
+			}
+		})
+	}
+}
+
+// upload posts data as the "image" file of a multipart form.
+func (ts *testServer) upload(path, token string, data []byte) (*http.Response, string) {
+	ts.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "upload.bin")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, &body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", token)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp, string(respBody)
+}
+
+func TestProfileImageUpload(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		user := ts.register("1JS21CS001", "")
+
+		resp, body := ts.upload("/api/profile/image", user.Token, encodePNG(t, testImage(800, 600)))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+		}
+		prefix := "/uploads/profiles/" + user.ID.String() + "/"
+		if !strings.Contains(body, `"url":"`+prefix) || !strings.Contains(body, `_thumb.png"`) {
+			t.Fatalf("upload response %s", body)
+		}
+
+		var profile User
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/profile", user.Token, nil, &profile)
+		if !strings.HasPrefix(profile.ProfileImage, prefix) {
+			t.Fatalf("profile image %q", profile.ProfileImage)
+		}
+		img, err := http.Get(ts.URL + profile.ProfileImage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img.Body.Close()
+		if img.StatusCode != http.StatusOK || img.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("GET %s: %d %s", profile.ProfileImage, img.StatusCode, img.Header.Get("Content-Type"))
+		}
+		if status := ts.do(http.MethodGet, "/uploads/profiles/", "", nil, nil); status != http.StatusNotFound {
+			t.Errorf("upload directory listing: status %d", status)
+		}
+
+		if resp, _ := ts.upload("/api/profile/image", user.Token, []byte("plain text")); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("text upload: status %d", resp.StatusCode)
+		}
+		if resp, _ := ts.upload("/api/profile/image", "", encodePNG(t, testImage(10, 10))); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("anonymous upload: status %d", resp.StatusCode)
+		}
+	})
+}
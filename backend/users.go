@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDirectoryLimit = 50
+	maxDirectoryLimit     = 200
+)
+
+type groupSummary struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Role string    `json:"role"`
+}
+
+type attendedEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	EventDate time.Time `json:"event_date"`
+}
+
+// publicProfile is what other users see of a profile. The USN and what it
+// encodes are only filled in for the user themselves and admins.
+type publicProfile struct {
+	ID             uuid.UUID       `json:"id"`
+	USN            string          `json:"usn,omitempty"`
+	Name           string          `json:"name"`
+	AdmissionYear  int             `json:"admission_year,omitempty"`
+	Branch         string          `json:"branch,omitempty"`
+	Bio            string          `json:"bio"`
+	ProfileImage   string          `json:"profile_image"`
+	Groups         []groupSummary  `json:"groups,omitempty"`
+	AttendedEvents []attendedEvent `json:"attended_events,omitempty"`
+}
+
+// seesEverything reports whether the caller bypasses user's privacy settings.
+func (s *Server) seesEverything(r *http.Request, user User) bool {
+	return s.getRoleFromToken(r) == "admin" || s.getUserIDFromToken(r) == user.ID
+}
+
+func (s *Server) newPublicProfile(r *http.Request, user User) publicProfile {
+	profile := publicProfile{
+		ID:           user.ID,
+		Name:         user.Name,
+		Bio:          user.Bio,
+		ProfileImage: user.ProfileImage,
+	}
+	if s.seesEverything(r, user) {
+		profile.USN, profile.AdmissionYear, profile.Branch = user.USN, user.AdmissionYear, user.Branch
+	}
+	if user.Privacy.ShowGroups || s.seesEverything(r, user) {
+		profile.Groups = []groupSummary{}
+		for _, m := range user.Memberships {
+			if m.Group != nil {
+				profile.Groups = append(profile.Groups, groupSummary{ID: m.Group.ID, Name: m.Group.Name, Role: m.Role})
+			}
+		}
+	}
+	return profile
+}
+
+// loadAttendedEvents lists the events user checked in to, leaving out any
+// the caller isn't allowed to see.
+func (s *Server) loadAttendedEvents(r *http.Request, userID uuid.UUID) []attendedEvent {
+	events := []attendedEvent{}
+	attended, _ := s.Events.Attended(s.viewerFromRequest(r), userID)
+	for _, e := range attended {
+		events = append(events, attendedEvent{ID: e.ID, Title: e.Title, EventDate: e.EventDate})
+	}
+	return events
+}
+
+// handleUserProfile returns the public profile of a user, looked up by ID
+// or USN.
+func (s *Server) handleUserProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ref := r.PathValue("ref")
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		byUSN, usnErr := findUserByUSN(s.Users, ref)
+		id, err = byUSN.ID, usnErr
+	}
+	var user User
+	if err == nil {
+		user, err = s.Users.GetProfile(id)
+	}
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	profile := s.newPublicProfile(r, user)
+	if user.Privacy.ShowAttendance || s.seesEverything(r, user) {
+		profile.AttendedEvents = s.loadAttendedEvents(r, user.ID)
+	}
+	json.NewEncoder(w).Encode(profile)
+}
+
+// handleUserDirectory lists users who opted into the directory. ?q= matches
+// name (and USN for admins), ?year= and ?branch= filter admins' results on
+// the parsed USN, ?group_id= limits to members of a group who show their
+// groups, and ?limit=/?offset= page through the results.
+func (s *Server) handleUserDirectory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := defaultDirectoryLimit, 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxDirectoryLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	admin := s.getRoleFromToken(r) == "admin"
+	query := UserQuery{
+		Text:            strings.TrimSpace(r.URL.Query().Get("q")),
+		MatchUSN:        admin,
+		Branch:          strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("branch"))),
+		IncludeUnlisted: admin,
+		Limit:           limit,
+		Offset:          offset,
+	}
+	if raw := r.URL.Query().Get("year"); raw != "" {
+		year, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		query.AdmissionYear = year
+	}
+	// Others don't see USNs, so they can't filter on what's in them either.
+	if !admin && (query.Branch != "" || query.AdmissionYear != 0) {
+		http.Error(w, "Only admins can filter by year or branch", http.StatusForbidden)
+		return
+	}
+	if raw := r.URL.Query().Get("group_id"); raw != "" {
+		groupID, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+		query.GroupID = groupID
+		// Filtering by group would otherwise reveal hidden memberships.
+		query.ShowingGroups = !admin
+	}
+
+	users, total, err := s.Users.Search(query)
+	if err != nil {
+		http.Error(w, "Could not search users", http.StatusInternalServerError)
+		return
+	}
+
+	profiles := make([]publicProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, s.newPublicProfile(r, user))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": profiles,
+		"total": total,
+	})
+}
+
+type privacyInput struct {
+	ListedInDirectory *bool `json:"listed_in_directory"`
+	ShowGroups        *bool `json:"show_groups"`
+	ShowAttendance    *bool `json:"show_attendance"`
+}
+
+// applyPrivacyUpdate copies the privacy fields present in input to settings.
+func applyPrivacyUpdate(settings *PrivacySettings, input *privacyInput) {
+	if input.ListedInDirectory != nil {
+		settings.ListedInDirectory = *input.ListedInDirectory
+	}
+	if input.ShowGroups != nil {
+		settings.ShowGroups = *input.ShowGroups
+	}
+	if input.ShowAttendance != nil {
+		settings.ShowAttendance = *input.ShowAttendance
+	}
+}
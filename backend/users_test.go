@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type directoryPage struct {
+	Users []publicProfile `json:"users"`
+	Total int64           `json:"total"`
+}
+
+// TestDirectorySearchIsLiteral checks that LIKE wildcards in ?q= match only
+// themselves.
+func TestDirectorySearchIsLiteral(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		for usn, name := range map[string]string{
+			"1JS21CS001": "Asha Rao",
+			"1JS21CS002": "Ravi_Kumar",
+			"1JS21CS003": "Ravi Kumar",
+			"1JS21CS004": "100% Dev",
+			"1JS21CS005": `Back\slash`,
+		} {
+			user := ts.register(usn, "")
+			ts.mustDo(http.StatusOK, http.MethodPut, "/api/profile", user.Token, map[string]string{"name": name}, nil)
+		}
+		viewer := ts.register("1JS21CS006", "")
+
+		for q, want := range map[string]int64{
+			"%":        1,
+			"_":        1,
+			"ravi_":    1,
+			"ravi":     2,
+			`\`:        1,
+			`k\\s`:     0,
+			"100% dev": 1,
+		} {
+			var page directoryPage
+			ts.mustDo(http.StatusOK, http.MethodGet, "/api/users?q="+url.QueryEscape(q), viewer.Token, nil, &page)
+			if page.Total != want {
+				t.Errorf("q=%q: %d matches, want %d", q, page.Total, want)
+			}
+		}
+	})
+}
+
+// TestProfileHidesUSN checks that only the user and admins see the USN and
+// the year and branch read from it.
+func TestProfileHidesUSN(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		admin := ts.register("1JS20CS100", "admin")
+		alice := ts.register("1JS21CS001", "")
+		bob := ts.register("1JS21CS002", "")
+		ts.mustDo(http.StatusOK, http.MethodPut, "/api/profile", alice.Token, map[string]string{"name": "Asha Rao"}, nil)
+
+		for name, tc := range map[string]struct {
+			token string
+			sees  bool
+		}{
+			"self":  {alice.Token, true},
+			"admin": {admin.Token, true},
+			"other": {bob.Token, false},
+		} {
+			var profile publicProfile
+			ts.mustDo(http.StatusOK, http.MethodGet, "/api/users/"+alice.ID.String(), tc.token, nil, &profile)
+			if got := profile.USN == alice.USN && profile.AdmissionYear == 2021 && profile.Branch == "CS"; got != tc.sees {
+				t.Errorf("%s sees %q, %d, %q", name, profile.USN, profile.AdmissionYear, profile.Branch)
+			}
+			if profile.Name != "Asha Rao" {
+				t.Errorf("%s sees name %q", name, profile.Name)
+			}
+		}
+
+		var page directoryPage
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/users?q=1js21", bob.Token, nil, &page)
+		if page.Total != 0 {
+			t.Errorf("USN search matched %d users for a student", page.Total)
+		}
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/users?q=1js21", admin.Token, nil, &page)
+		if page.Total != 2 {
+			t.Errorf("USN search matched %d users for an admin", page.Total)
+		}
+		ts.mustDo(http.StatusForbidden, http.MethodGet, "/api/users?year=2021", bob.Token, nil, nil)
+		ts.mustDo(http.StatusForbidden, http.MethodGet, "/api/users?branch=cs", bob.Token, nil, nil)
+		ts.mustDo(http.StatusOK, http.MethodGet, "/api/users?year=2021&branch=cs", admin.Token, nil, &page)
+		if page.Total != 2 {
+			t.Errorf("admin filter matched %d users", page.Total)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// collegeCode is the region digit and college letters every USN issued by
+// our college starts with.
+const collegeCode = "1JS"
+
+// A VTU USN is college code, admission year, branch and roll number, e.g.
+// 1JS21CS001. PG programmes use a three-letter branch and two-digit roll
+// (1JS22MCA01), so the total is always ten characters.
+var usnPattern = regexp.MustCompile(`^([0-9][A-Z]{2})([0-9]{2})([A-Z]{2}[0-9]{3}|[A-Z]{3}[0-9]{2})$`)
+
+type ParsedUSN struct {
+	USN     string // Normalized form
+	College string
+	Year    int // Four-digit admission year
+	Branch  string
+	Roll    int
+}
+
+// normalizeUSN upper-cases s and drops whitespace and dashes, so
+// " 1js21-cs001" and "1JS21CS001" are the same account.
+func normalizeUSN(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(s))
+}
+
+// parseUSN normalizes and validates a USN of our college.
+func parseUSN(s string) (ParsedUSN, error) {
+	usn := normalizeUSN(s)
+	if usn == "" {
+		return ParsedUSN{}, fmt.Errorf("USN is required")
+	}
+	m := usnPattern.FindStringSubmatch(usn)
+	if m == nil {
+		return ParsedUSN{}, fmt.Errorf("USN must look like %s21CS001", collegeCode)
+	}
+	if m[1] != collegeCode {
+		return ParsedUSN{}, fmt.Errorf("USN must start with %s", collegeCode)
+	}
+
+	yy, _ := strconv.Atoi(m[2])
+	year := 2000 + yy
+	if year > time.Now().Year()+1 {
+		return ParsedUSN{}, fmt.Errorf("USN has an invalid admission year")
+	}
+
+	rest := m[3]
+	split := 2
+	if rest[2] >= 'A' && rest[2] <= 'Z' {
+		split = 3
+	}
+	roll, _ := strconv.Atoi(rest[split:])
+	if roll == 0 {
+		return ParsedUSN{}, fmt.Errorf("USN has an invalid roll number")
+	}
+
+	return ParsedUSN{
+		USN:     usn,
+		College: m[1],
+		Year:    year,
+		Branch:  rest[:split],
+		Roll:    roll,
+	}, nil
+}
+
+// findUserByUSN looks up the account for a USN as the user typed it. The
+// exact form is tried before the normalized one, since a legacy USN that
+// normalizes to another account's is stored as it was typed (see
+// backfillUSNDetails).
+func findUserByUSN(users UserStore, input string) (User, error) {
+	user, err := users.GetByUSN(strings.TrimSpace(input))
+	if err != nil {
+		user, err = users.GetByUSN(normalizeUSN(input))
+	}
+	return user, err
+}
+
+// backfillUSNDetails normalizes the USNs of accounts created before they
+// were validated and fills in admission year and branch. USNs that don't
+// parse (e.g. staff accounts) or whose normalized form is already taken are
+// left alone.
+func backfillUSNDetails(db *gorm.DB) error {
+	var users []User
+	if err := db.Where("admission_year = 0 OR admission_year IS NULL").Find(&users).Error; err != nil {
+		return fmt.Errorf("reading users without USN details: %w", err)
+	}
+	for _, user := range users {
+		parsed, err := parseUSN(user.USN)
+		if err != nil {
+			continue
+		}
+		if parsed.USN != user.USN {
+			var taken int64
+			if err := db.Model(&User{}).Where("usn = ? AND id <> ?", parsed.USN, user.ID).Count(&taken).Error; err != nil {
+				return fmt.Errorf("checking whether %s is taken: %w", parsed.USN, err)
+			}
+			if taken > 0 {
+				log.Printf("Not normalizing USN %q: %s is already registered; the account still logs in as %q until an admin merges the two", user.USN, parsed.USN, user.USN)
+				continue
+			}
+		}
+		err = db.Model(&user).UpdateColumns(map[string]interface{}{
+			"usn":            parsed.USN,
+			"admission_year": parsed.Year,
+			"branch":         parsed.Branch,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("normalizing USN %q: %w", user.USN, err)
+		}
+	}
+	return nil
+}
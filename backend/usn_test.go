@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseUSN(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ParsedUSN
+		err  bool
+	}{
+		{in: "1JS21CS001", want: ParsedUSN{USN: "1JS21CS001", College: "1JS", Year: 2021, Branch: "CS", Roll: 1}},
+		{in: " 1js21cs042\n", want: ParsedUSN{USN: "1JS21CS042", College: "1JS", Year: 2021, Branch: "CS", Roll: 42}},
+		{in: "1js-21-cs-042", want: ParsedUSN{USN: "1JS21CS042", College: "1JS", Year: 2021, Branch: "CS", Roll: 42}},
+		{in: "1JS 21 IS\t100", want: ParsedUSN{USN: "1JS21IS100", College: "1JS", Year: 2021, Branch: "IS", Roll: 100}},
+		// Lateral entries join in the second year with 4xx roll numbers.
+		{in: "1JS22EC412", want: ParsedUSN{USN: "1JS22EC412", College: "1JS", Year: 2022, Branch: "EC", Roll: 412}},
+		// PG programmes have a three-letter branch and a two-digit roll.
+		{in: "1js22mca05", want: ParsedUSN{USN: "1JS22MCA05", College: "1JS", Year: 2022, Branch: "MCA", Roll: 5}},
+		{in: "1JS23MBA60", want: ParsedUSN{USN: "1JS23MBA60", College: "1JS", Year: 2023, Branch: "MBA", Roll: 60}},
+		{in: "", err: true},
+		{in: " - ", err: true},
+		{in: "1RV21CS001", err: true},  // Another college
+		{in: "2JS21CS001", err: true},  // Another region
+		{in: "1JS21CS000", err: true},  // Roll numbers start at 1
+		{in: "1JS22MCA00", err: true},  // Likewise for PG
+		{in: "1JS99CS001", err: true},  // Admission year in the future
+		{in: "1JS21CS01", err: true},   // UG roll is three digits
+		{in: "1JS22MCA001", err: true}, // PG roll is two digits
+		{in: "1JS21C5001", err: true},
+		{in: "1JS2ICS001", err: true},
+		{in: "JS21CS001", err: true},
+		{in: "1JS21CS001X", err: true},
+		{in: "admin", err: true},
+	} {
+		got, err := parseUSN(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseUSN(%q) = %+v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseUSN(%q) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestBackfillUSNDetails(t *testing.T) {
+	db := sqliteTestDB(t)
+	create := func(usn string) User {
+		t.Helper()
+		user := User{USN: usn}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	legacy := create("1js21cs001")
+	taken := create("1JS21CS002")
+	duplicate := create("1js21-cs002") // Normalizes to taken's USN
+	staff := create("admin")
+
+	if err := backfillUSNDetails(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		user   User
+		usn    string
+		year   int
+		branch string
+	}{
+		{legacy, "1JS21CS001", 2021, "CS"},
+		{taken, "1JS21CS002", 2021, "CS"},
+		{duplicate, "1js21-cs002", 0, ""},
+		{staff, "admin", 0, ""},
+	} {
+		var got User
+		if err := db.First(&got, "id = ?", tc.user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.USN != tc.usn || got.AdmissionYear != tc.year || got.Branch != tc.branch {
+			t.Errorf("%q became %q (%d, %q), want %q (%d, %q)", tc.user.USN, got.USN, got.AdmissionYear, got.Branch, tc.usn, tc.year, tc.branch)
+		}
+	}
+}
+
+// TestLoginWithCollidingLegacyUSN checks that both accounts can still log
+// in after the backfill leaves a colliding legacy USN as it was.
+func TestLoginWithCollidingLegacyUSN(t *testing.T) {
+	db := sqliteTestDB(t)
+	taken := User{USN: "1JS21CS002", Role: "user"}
+	duplicate := User{USN: "1js21-cs002", Role: "user"}
+	for _, user := range []*User{&taken, &duplicate} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := backfillUSNDetails(db); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, newGormStores(db))
+
+	for input, want := range map[string]User{
+		"1js21-cs002":   duplicate,
+		" 1js21-cs002 ": duplicate,
+		"1JS21CS002":    taken,
+		"1js21cs002":    taken,
+		"1JS21 CS002":   taken,
+	} {
+		var resp struct {
+			User User `json:"user"`
+		}
+		ts.mustDo(http.StatusOK, http.MethodPost, "/api/login", "", map[string]string{"usn": input}, &resp)
+		if resp.User.ID != want.ID {
+			t.Errorf("%q logged in as %q, want %q", input, resp.User.USN, want.USN)
+		}
+	}
+}
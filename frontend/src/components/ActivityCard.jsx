@@ -27,7 +27,14 @@ const ActivityCard = ({ activity, user, idx }) => {
             console.error(error);
             setStatus('ERROR');
             if (error.response?.status === 409) {
-                setMsg('ALREADY_REG');
+                const body = error.response.data;
+                if (body?.conflicts) {
+                    setMsg('TIME_CONFLICT');
+                } else if (typeof body === 'string' && body.includes('full')) {
+                    setMsg('FULL');
+                } else {
+                    setMsg('ALREADY_REG');
+                }
             } else {
                 setMsg('FAILED');
             }
@@ -9,7 +9,7 @@ const AdminDashboard = ({ user }) => {
     const [events, setEvents] = useState([]);
     const [groups, setGroups] = useState([]);
     const [activities, setActivities] = useState([]);
-    const [registrations, setRegistrations] = useState({});
+    const [checkInStats, setCheckInStats] = useState({});
 
     // Form states
     const [roomForm, setRoomForm] = useState({ title: '', description: '', timer_minutes: 30 });
@@ -21,6 +21,17 @@ const AdminDashboard = ({ user }) => {
         fetchData();
     }, []);
 
+    // Live registration / check-in counts for every event
+    useEffect(() => {
+        const token = localStorage.getItem('token');
+        const ws = new WebSocket(`${import.meta.env.VITE_WS_BASE_URL}/ws/checkins?token=${encodeURIComponent(token)}`);
+        ws.onmessage = (e) => {
+            const update = JSON.parse(e.data);
+            setCheckInStats(prev => ({ ...prev, [update.event_id]: update.stats }));
+        };
+        return () => ws.close();
+    }, []);
+
     const fetchData = async () => {
         const token = localStorage.getItem('token');
         const [roomsRes, eventsRes, groupsRes, activitiesRes] = await Promise.all([
@@ -33,18 +44,6 @@ const AdminDashboard = ({ user }) => {
         setEvents(eventsRes.data || []);
         setGroups(groupsRes.data || []);
         setActivities(activitiesRes.data || []);
-
-        // Fetch registrations for each event
-        const regs = {};
-        for (const event of eventsRes.data || []) {
-            try {
-                const regRes = await axios.get(`${import.meta.env.VITE_API_BASE_URL}/api/events/registrations?event_id=${event.id}`, { headers: { Authorization: token } });
-                regs[event.id] = regRes.data || [];
-            } catch (err) {
-                console.error(`Error fetching registrations for event ${event.id}`, err);
-            }
-        }
-        setRegistrations(regs);
     };
 
     const createRoom = async (e) => {
@@ -273,6 +272,19 @@ const AdminDashboard = ({ user }) => {
                                 <label className="input-label">"DESCRIPTION"</label>
                                 <textarea className="input-industrial" style={{ height: '80px', resize: 'none' }} value={eventForm.description} onChange={e => setEventForm({ ...eventForm, description: e.target.value })} />
                             </div>
+                            <div className="input-wrapper">
+                                <label className="input-label">"MEMBERS_ONLY"</label>
+                                <select
+                                    multiple
+                                    className="input-industrial"
+                                    value={eventForm.group_ids || []}
+                                    onChange={e => setEventForm({ ...eventForm, group_ids: Array.from(e.target.selectedOptions, o => o.value) })}
+                                >
+                                    {groups.map(g => (
+                                        <option key={g.id} value={g.id}>{g.name.toUpperCase()}</option>
+                                    ))}
+                                </select>
+                            </div>
                             <button type="submit" className="btn-industrial hover-glitch" style={{ background: 'var(--white)', color: 'var(--black)', justifyContent: 'center' }}>"POST_EVENT"</button>
                         </form>
                     </motion.div>
@@ -285,7 +297,7 @@ const AdminDashboard = ({ user }) => {
                                 <div key={event.id} style={{ padding: '20px', background: 'var(--black)', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
                                     <div>
                                         <div className="caps" style={{ fontWeight: '800', fontSize: '14px' }}>{event.title}</div>
-                                        <div className="monospaced" style={{ fontSize: '9px', opacity: 0.5 }}>REGS: {registrations[event.id]?.length || 0} / {event.capacity || '∞'}</div>
+                                        <div className="monospaced" style={{ fontSize: '9px', opacity: 0.5 }}>REGS: {checkInStats[event.id]?.registered || 0} / {event.capacity || '∞'} // IN: {checkInStats[event.id]?.inside || 0} // ATTENDED: {checkInStats[event.id]?.checked_in || 0} // WAITLIST: {checkInStats[event.id]?.waitlisted || 0}</div>
                                     </div>
                                     <div className="flex gap-2">
                                         <div className="tag-zip">{event.category}</div>
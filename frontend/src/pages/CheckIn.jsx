@@ -48,12 +48,13 @@ const CheckIn = () => {
         setScanResult(null);
         try {
             const apiToken = localStorage.getItem('token');
-            const response = await axios.post(`${API_BASE_URL}/events/checkin`,
+            // Works for both event tickets and activity passes
+            const response = await axios.post(`${API_BASE_URL}/checkin/scan`,
                 { qr_code_token: token },
                 { headers: { Authorization: apiToken } }
             );
             setScanResult('success');
-            setScannedData(response.data);
+            setScannedData(response.data.registration);
         } catch (err) {
             setScanResult('error');
             setError(err.response?.data || "SYSTEM_ERROR // SCAN_REJECTED");
@@ -122,7 +123,7 @@ const CheckIn = () => {
                                     </div>
                                     <div>
                                         <span className="text-[9px] opacity-40 block">ACTIVITY</span>
-                                        <span className="text-sm font-bold text-green-400">{scannedData?.event?.title || 'UNKNOWN'}</span>
+                                        <span className="text-sm font-bold text-green-400">{scannedData?.event?.title || scannedData?.activity?.title || 'UNKNOWN'}</span>
                                     </div>
                                 </div>
                                 <div className="mt-6 pt-4 border-t border-white/10 w-full flex justify-between text-[10px] opacity-40 monospaced">
@@ -30,7 +30,10 @@ const EventDetails = ({ user }) => {
 
     const fetchData = async () => {
         try {
-            const response = await axios.get(`${API_BASE_URL}/events`);
+            const token = localStorage.getItem('token');
+            const response = await axios.get(`${API_BASE_URL}/events`, {
+                headers: { Authorization: token }
+            });
             const found = response.data.find(e => e.id === id);
             setEvent(found);
         } catch (err) {
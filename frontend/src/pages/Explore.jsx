@@ -23,14 +23,14 @@ const Explore = ({ user }) => {
                         return [];
                     });
 
-                const fetchEvents = axios.get(`${import.meta.env.VITE_API_BASE_URL}/api/events`)
+                const fetchEvents = axios.get(`${import.meta.env.VITE_API_BASE_URL}/api/events`, { headers: { Authorization: token } })
                     .then(res => res.data)
                     .catch(err => {
                         console.error("Events fetch failed", err);
                         return [];
                     });
 
-                const fetchActivities = axios.get(`${import.meta.env.VITE_API_BASE_URL}/api/activities`)
+                const fetchActivities = axios.get(`${import.meta.env.VITE_API_BASE_URL}/api/activities`, { headers: { Authorization: token } })
                     .then(res => res.data)
                     .catch(err => {
                         console.error("Activities fetch failed", err);
@@ -5,6 +5,9 @@ import { motion } from 'framer-motion';
 
 const API_BASE_URL = `${import.meta.env.VITE_API_BASE_URL}/api`;
 
+// Locally stored uploads come back as server-relative paths
+const imageSrc = (url) => url?.startsWith('/') ? `${import.meta.env.VITE_API_BASE_URL}${url}` : url;
+
 const Profile = ({ user, setUser }) => {
     const [profile, setProfile] = useState(null);
     const [groups, setGroups] = useState([]);
@@ -12,6 +15,7 @@ const Profile = ({ user, setUser }) => {
     const [editedProfile, setEditedProfile] = useState({});
     const [loading, setLoading] = useState(true);
     const [message, setMessage] = useState({ type: '', text: '' });
+    const [uploading, setUploading] = useState(false);
 
     useEffect(() => {
         fetchProfile();
@@ -48,21 +52,68 @@ const Profile = ({ user, setUser }) => {
     const handleUpdate = async () => {
         try {
             const token = localStorage.getItem('token');
-            await axios.put(`${API_BASE_URL}/profile`, editedProfile, {
+            const { join_group_id } = editedProfile;
+            const updateRes = await axios.patch(`${API_BASE_URL}/profile`, {
+                name: editedProfile.name,
+                bio: editedProfile.bio || null,
+                profile_image: editedProfile.profile_image || null,
+                privacy: editedProfile.privacy
+            }, {
                 headers: { Authorization: token }
             });
-            setProfile(editedProfile);
+            const saved = { ...profile, ...updateRes.data };
+
+            // Groups are joined through their own endpoint; approval groups queue a request
+            let status = 'SYSTEM_STATUS // PROFILE_UPDATED';
+            if (join_group_id) {
+                const joinRes = await axios.post(`${API_BASE_URL}/groups/${join_group_id}/join`, {}, {
+                    headers: { Authorization: token }
+                });
+                if (joinRes.data.status === 'pending') {
+                    status = 'SYSTEM_STATUS // JOIN_REQUEST_PENDING';
+                } else {
+                    status = 'SYSTEM_STATUS // GROUP_JOINED';
+                    fetchProfile();
+                }
+            }
+
+            setProfile(saved);
+            setEditedProfile(saved);
             setIsEditing(false);
-            setMessage({ type: 'success', text: 'SYSTEM_STATUS // PROFILE_UPDATED' });
+            setMessage({ type: 'success', text: status });
 
             // Update local storage user if needed
-            const updatedUser = { ...user, ...editedProfile };
+            const updatedUser = { ...user, ...saved };
             setUser(updatedUser);
             localStorage.setItem('user', JSON.stringify(updatedUser));
 
             setTimeout(() => setMessage({ type: '', text: '' }), 3000);
         } catch (error) {
-            setMessage({ type: 'error', text: 'SYSTEM_ERROR // UPDATE_FAILED' });
+            const reason = typeof error.response?.data === 'string' ? error.response.data.trim().toUpperCase().replace(/\s+/g, '_') : 'UPDATE_FAILED';
+            setMessage({ type: 'error', text: `SYSTEM_ERROR // ${reason}` });
+            setTimeout(() => setMessage({ type: '', text: '' }), 3000);
+        }
+    };
+
+    const handleImageUpload = async (e) => {
+        const file = e.target.files[0];
+        if (!file) return;
+        const form = new FormData();
+        form.append('image', file);
+        setUploading(true);
+        try {
+            const token = localStorage.getItem('token');
+            const response = await axios.post(`${API_BASE_URL}/profile/image`, form, {
+                headers: { Authorization: token }
+            });
+            setProfile({ ...profile, profile_image: response.data.url });
+            setEditedProfile({ ...editedProfile, profile_image: response.data.url });
+            setMessage({ type: 'success', text: 'SYSTEM_STATUS // IMAGE_UPLOADED' });
+        } catch (error) {
+            const reason = typeof error.response?.data === 'string' ? error.response.data.trim().toUpperCase().replace(/\s+/g, '_') : 'UPLOAD_FAILED';
+            setMessage({ type: 'error', text: `SYSTEM_ERROR // ${reason}` });
+        } finally {
+            setUploading(false);
             setTimeout(() => setMessage({ type: '', text: '' }), 3000);
         }
     };
@@ -150,11 +201,28 @@ const Profile = ({ user, setUser }) => {
                                         overflow: 'hidden'
                                     }}>
                                         {profile?.profile_image ? (
-                                            <img src={profile.profile_image} alt="Profile" style={{ width: '100%', height: '100%', objectFit: 'cover' }} />
+                                            <img src={imageSrc(profile.profile_image)} alt="Profile" style={{ width: '100%', height: '100%', objectFit: 'cover' }} />
                                         ) : (
                                             <User size={80} style={{ color: '#3f3f46' }} />
                                         )}
                                     </div>
+                                    {isEditing && (
+                                        <label style={{
+                                            position: 'absolute',
+                                            top: '-16px',
+                                            left: '-16px',
+                                            background: '#fff',
+                                            color: '#000',
+                                            padding: '4px 12px',
+                                            fontSize: '10px',
+                                            fontWeight: '900',
+                                            letterSpacing: '0.15em',
+                                            cursor: 'pointer'
+                                        }}>
+                                            {uploading ? 'UPLOADING...' : 'UPLOAD'}
+                                            <input type="file" accept="image/jpeg,image/png,image/gif,image/webp" onChange={handleImageUpload} style={{ display: 'none' }} />
+                                        </label>
+                                    )}
                                     <div style={{
                                         position: 'absolute',
                                         bottom: '-16px',
@@ -296,11 +364,11 @@ const Profile = ({ user, setUser }) => {
                                                 textTransform: 'uppercase',
                                                 marginBottom: '12px',
                                                 opacity: 0.6
-                                            }}>"JOINED_GROUP"</label>
+                                            }}>"JOINED_GROUPS"</label>
                                             {isEditing ? (
                                                 <select
-                                                    value={editedProfile.group_id || ''}
-                                                    onChange={(e) => setEditedProfile({ ...editedProfile, group_id: e.target.value })}
+                                                    value={editedProfile.join_group_id || ''}
+                                                    onChange={(e) => setEditedProfile({ ...editedProfile, join_group_id: e.target.value })}
                                                     style={{
                                                         background: '#000',
                                                         border: '1px solid rgba(255,255,255,0.2)',
@@ -313,8 +381,8 @@ const Profile = ({ user, setUser }) => {
                                                         cursor: 'pointer'
                                                     }}
                                                 >
-                                                    <option value="">SELECT_GROUP</option>
-                                                    {groups.map(g => (
+                                                    <option value="">JOIN_GROUP</option>
+                                                    {groups.filter(g => !profile?.memberships?.some(m => m.group_id === g.id)).map(g => (
                                                         <option key={g.id} value={g.id}>{g.name.toUpperCase()}</option>
                                                     ))}
                                                 </select>
@@ -322,13 +390,44 @@ const Profile = ({ user, setUser }) => {
                                                 <div style={{ display: 'flex', alignItems: 'center', gap: '12px' }}>
                                                     <Users size={20} style={{ color: '#71717a' }} />
                                                     <span style={{ textTransform: 'uppercase', fontWeight: '900' }}>
-                                                        {groups.find(g => g.id === profile?.group_id)?.name || 'NONE'}
+                                                        {profile?.memberships?.length
+                                                            ? profile.memberships.map(m => m.group?.name).join(' / ')
+                                                            : 'NONE'}
                                                     </span>
                                                 </div>
                                             )}
                                         </div>
                                     </div>
 
+                                    {/* PRIVACY SECTION */}
+                                    {isEditing && (
+                                        <div style={{ width: '100%', borderTop: '1px solid rgba(255,255,255,0.1)', paddingTop: '24px', marginBottom: '40px', textAlign: 'left' }}>
+                                            <label style={{
+                                                display: 'block',
+                                                fontSize: '11px',
+                                                fontWeight: '700',
+                                                letterSpacing: '0.1em',
+                                                textTransform: 'uppercase',
+                                                marginBottom: '12px',
+                                                opacity: 0.6
+                                            }}>"PRIVACY"</label>
+                                            {[
+                                                ['listed_in_directory', 'LIST_IN_DIRECTORY'],
+                                                ['show_groups', 'SHOW_GROUPS'],
+                                                ['show_attendance', 'SHOW_ATTENDED_EVENTS']
+                                            ].map(([key, label]) => (
+                                                <label key={key} style={{ display: 'flex', alignItems: 'center', gap: '12px', marginBottom: '8px', fontSize: '12px', fontWeight: '700', cursor: 'pointer' }}>
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!editedProfile.privacy?.[key]}
+                                                        onChange={(e) => setEditedProfile({ ...editedProfile, privacy: { ...editedProfile.privacy, [key]: e.target.checked } })}
+                                                    />
+                                                    {label}
+                                                </label>
+                                            ))}
+                                        </div>
+                                    )}
+
                                     {/* REGISTERED ACTIVITIES SECTION */}
                                     {profile?.activity_registrations && profile.activity_registrations.length > 0 && (
                                         <div style={{